@@ -12,6 +12,9 @@ const (
 	defHoldThreshold = 500 * time.Millisecond
 	// In diesem Intervall werden die Hold-Events erzeugt.
 	defHoldCallRate = 100 * time.Millisecond
+	// Maximaler Abstand zwischen Loslassen und erneutem Druecken, damit
+	// Klicks als Mehrfachklick zusammengefasst werden.
+	defClickWindow = 300 * time.Millisecond
 )
 
 // Enthaelt alle wichtigen Konfigurationseinstellungen zu einem Push-Button
@@ -22,6 +25,15 @@ type ButtonConfig struct {
 	// In diesem zeitlichen Abstand wird bei konstantem Druecken des Buttons
 	// der Hold-Callback aufgerufen.
 	HoldCallRate time.Duration
+	// Beschleunigung der Hold-Events bei langem Halten (Default: keine).
+	// Die Stufen muessen nach HoldStage.After aufsteigend sortiert sein.
+	HoldAccel []HoldStage
+	// Maximaler Abstand zwischen dem Loslassen und dem erneuten Druecken
+	// des Buttons bei Doppel- und Dreifachklicks (Default: 300 ms).
+	ClickWindow time.Duration
+	// Entprellung des Eingangs (Default: keine). Die Zeiten bzw. Anzahl
+	// Samples beziehen sich auf die Aufrufe von Process.
+	Debounce DebounceConfig
 }
 
 // Funktionstyp der Callback-Handler fuer die Events Pressed, Push und Release.
@@ -30,24 +42,71 @@ type ButtonCallback func()
 // Funktionstyp des Callback-Handlers fuer das Event Hold.
 type ButtonHoldCallback func(firstCall bool)
 
+// Funktionstyp des Callback-Handlers fuer das Event Hold mit Beschleunigung.
+// steps ist die Schrittweite gemaess der aktuellen Stufe von
+// ButtonConfig.HoldAccel (beim ersten Aufruf immer 1).
+type ButtonHoldStepsCallback func(firstCall bool, steps int)
+
+// Eine Stufe der Beschleunigung von Hold-Events. Mit
+//
+//	HoldAccel: []tinylib.HoldStage{
+//	    {After: 10, Rate: 50 * time.Millisecond},
+//	    {After: 30, Steps: 5},
+//	}
+//
+// wird nach 10 Wiederholungen doppelt so schnell und nach 30 in Fuenfer-
+// schritten gezaehlt.
+type HoldStage struct {
+	// Ab dieser Anzahl Hold-Events (ohne den ersten) gilt die Stufe.
+	After int
+	// Intervall der Hold-Events (Default: Intervall der vorangehenden
+	// Stufe bzw. ButtonConfig.HoldCallRate bei der ersten).
+	Rate time.Duration
+	// Schrittweite, welche dem ButtonHoldStepsCallback uebergeben wird
+	// (Default: Schrittweite der vorangehenden Stufe bzw. 1 bei der
+	// ersten).
+	Steps int
+}
+
 // Mit diesem Typ koennen Push-Buttons auf vielfaeltige Weise angesteuert
-// werden. Wichtig: die Entprellung des Buttons muss hardwareseitig erfolgen!
-// Es gibt 4 Events, fuer welche entsprechende Callbacks hinterlegt werden
+// werden. Prellende Taster koennen mit ButtonConfig.Debounce softwareseitig
+// entprellt werden, ohne Konfiguration muss dies hardwareseitig erfolgen.
+// Es gibt 7 Events, fuer welche entsprechende Callbacks hinterlegt werden
 // koennen.
 //
-//	Push   : Druecken des Buttons (Aufruf: 1-mal)
-//	Release: Loslassen des Buttons (Aufruf: 1-mal)
-//	Pressed: Druecken und Loslassen innerhalb einer bestimmten Zeit
-//	         (Aufruf: 1-mal)
-//	Hold   : Druecken und Halten ueber einen bestimmten Zeitraum hinweg
-//	         (Aufruf: alle btnPollRate Millisekunden so lange der Button
-//	         gedrueckt bleibt).
+//	Push       : Druecken des Buttons (Aufruf: 1-mal)
+//	Release    : Loslassen des Buttons (Aufruf: 1-mal)
+//	Pressed    : Druecken und Loslassen innerhalb einer bestimmten Zeit
+//	             (Aufruf: 1-mal)
+//	Hold       : Druecken und Halten ueber einen bestimmten Zeitraum hinweg
+//	             (Aufruf: alle btnPollRate Millisekunden so lange der Button
+//	             gedrueckt bleibt).
+//	LongRelease: Loslassen nach mindestens HoldThreshold (Aufruf: 1-mal)
+//	DoubleClick: zwei kurze Klicks innerhalb von ClickWindow (Aufruf: 1-mal)
+//	TripleClick: drei kurze Klicks innerhalb von ClickWindow (Aufruf: 1-mal)
+//
+// Ohne Callbacks fuer DoubleClick und TripleClick wird Pressed direkt beim
+// Loslassen aufgerufen. Sind solche hinterlegt, so wird Pressed erst nach
+// Ablauf von ClickWindow aufgerufen und nur dann, wenn kein weiterer Klick
+// folgte. Dazu muss Process auch bei losgelassenem Button weiterhin
+// periodisch aufgerufen werden.
 type Button struct {
 	holdThreshold, holdCallRate  time.Duration
+	clickWindow                  time.Duration
 	pushTime, lastHoldCall       time.Time
+	releaseTime                  time.Time
 	isHolding                    bool
+	numClicks                    int
 	pressedCB, pushCB, releaseCB ButtonCallback
+	longReleaseCB                ButtonCallback
+	doubleClickCB, tripleClickCB ButtonCallback
 	holdCB                       ButtonHoldCallback
+	holdStepsCB                  ButtonHoldStepsCallback
+	holdAccel                    []HoldStage
+	numRepeats                   int
+	debouncer                    Debouncer
+	combos                       []*ButtonCombo
+	inCombo                      bool
 }
 
 // Erzeugt ein neues Button-Objekt und verwendet pin als Input. Der Button
@@ -60,7 +119,13 @@ func (b *Button) Configure(cfg ButtonConfig) {
 		cfg.HoldCallRate = defHoldCallRate
 	}
 	b.holdThreshold = cfg.HoldThreshold
+	if cfg.ClickWindow == 0 {
+		cfg.ClickWindow = defClickWindow
+	}
 	b.holdCallRate = cfg.HoldCallRate
+	b.holdAccel = cfg.HoldAccel
+	b.clickWindow = cfg.ClickWindow
+	b.debouncer.Configure(cfg.Debounce)
 }
 
 // Setzt cb als Callback-Handler fuer das Pressed-Event.
@@ -84,29 +149,69 @@ func (b *Button) SetOnHold(cb ButtonHoldCallback) {
 	b.holdCB = cb
 }
 
+// Wie SetOnHold, jedoch erhaelt der Handler zusaetzlich die Schrittweite
+// der aktuellen Beschleunigungsstufe (siehe ButtonConfig.HoldAccel).
+func (b *Button) SetOnHoldSteps(cb ButtonHoldStepsCallback) {
+	b.holdStepsCB = cb
+}
+
+// Setzt cb als Callback-Handler fuer das Loslassen nach langem Druecken.
+func (b *Button) SetOnLongRelease(cb ButtonCallback) {
+	b.longReleaseCB = cb
+}
+
+// Setzt cb als Callback-Handler fuer Doppelklicks.
+func (b *Button) SetOnDoubleClick(cb ButtonCallback) {
+	b.doubleClickCB = cb
+}
+
+// Setzt cb als Callback-Handler fuer Dreifachklicks.
+func (b *Button) SetOnTripleClick(cb ButtonCallback) {
+	b.tripleClickCB = cb
+}
+
 // In dieser Methode steckt die ganze Logik hinter dem Button. Diese Methode
 // kann entweder direkt alle btnPollRate Millisekunden aufgerufen werden
-// oder durch einen Task (siehe Methode Task()).
+// oder durch einen Task (siehe Methode Task()). Ist eine Entprellung
+// konfiguriert, so wird buttonDown zuerst durch diese gefiltert.
 func (b *Button) Process(buttonDown bool) {
-	now := time.Now().Truncate(time.Millisecond)
+	b.process(buttonDown, time.Now().Truncate(time.Millisecond))
+}
+
+func (b *Button) process(buttonDown bool, now time.Time) {
+	buttonDown = b.debouncer.Update(buttonDown, now)
 	if buttonDown {
 		if b.pushTime.IsZero() {
+			if b.numClicks > 0 && now.Sub(b.releaseTime) > b.clickWindow {
+				b.flushClicks()
+			}
 			b.pushTime = now
 			if b.pushCB != nil {
 				b.pushCB()
 			}
-		} else {
+			b.updateCombos()
+		} else if !b.inCombo {
 			if !b.isHolding && now.Sub(b.pushTime) >= b.holdThreshold {
+				// Ein Hold beendet eine angefangene Serie von Klicks.
+				b.flushClicks()
 				if b.holdCB != nil {
 					b.holdCB(true)
 				}
+				if b.holdStepsCB != nil {
+					b.holdStepsCB(true, 1)
+				}
 				b.isHolding = true
+				b.numRepeats = 0
 				b.lastHoldCall = now
 			}
-			if b.isHolding && now.Sub(b.lastHoldCall) >= b.holdCallRate {
+			if rate, steps := b.holdStage(); b.isHolding && now.Sub(b.lastHoldCall) >= rate {
 				if b.holdCB != nil {
 					b.holdCB(false)
 				}
+				if b.holdStepsCB != nil {
+					b.holdStepsCB(false, steps)
+				}
+				b.numRepeats++
 				b.lastHoldCall = now
 			}
 		}
@@ -115,14 +220,90 @@ func (b *Button) Process(buttonDown bool) {
 			if b.releaseCB != nil {
 				b.releaseCB()
 			}
-			if now.Sub(b.pushTime) < b.holdThreshold {
-				if b.pressedCB != nil {
-					b.pressedCB()
+			if b.inCombo {
+				// Gehoerte der Button zu einer ausgeloesten Kombination,
+				// so entfallen Pressed, Klicks und LongRelease.
+				b.inCombo = false
+			} else if now.Sub(b.pushTime) < b.holdThreshold {
+				b.numClicks++
+				b.releaseTime = now
+				if b.numClicks >= b.maxClicks() {
+					b.flushClicks()
+				}
+			} else {
+				b.flushClicks()
+				if b.longReleaseCB != nil {
+					b.longReleaseCB()
 				}
 			}
 			b.pushTime = time.Time{}
 			b.lastHoldCall = time.Time{}
 			b.isHolding = false
+			b.updateCombos()
+		} else if b.numClicks > 0 && now.Sub(b.releaseTime) > b.clickWindow {
+			b.flushClicks()
+		}
+	}
+}
+
+// Liefert Intervall und Schrittweite der Hold-Events gemaess der Stufe,
+// welche bei der aktuellen Anzahl Wiederholungen gilt. Nicht gesetzte
+// Werte einer Stufe werden von der vorangehenden uebernommen.
+func (b *Button) holdStage() (time.Duration, int) {
+	rate, steps := b.holdCallRate, 1
+	for _, stage := range b.holdAccel {
+		if b.numRepeats < stage.After {
+			break
+		}
+		if stage.Rate > 0 {
+			rate = stage.Rate
+		}
+		if stage.Steps > 0 {
+			steps = stage.Steps
+		}
+	}
+	return rate, steps
+}
+
+// Liefert true, solange der Button (entprellt) gedrueckt ist.
+func (b *Button) IsDown() bool {
+	return !b.pushTime.IsZero()
+}
+
+func (b *Button) updateCombos() {
+	for _, c := range b.combos {
+		c.update()
+	}
+}
+
+// Liefert die maximale Anzahl Klicks einer Serie. Bei 1 wird Pressed
+// sofort aufgerufen.
+func (b *Button) maxClicks() int {
+	switch {
+	case b.tripleClickCB != nil:
+		return 3
+	case b.doubleClickCB != nil:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Ruft fuer die angefangene Serie von Klicks den passenden Callback auf.
+// Fehlt dieser, so wird Pressed fuer jeden Klick aufgerufen.
+func (b *Button) flushClicks() {
+	n := b.numClicks
+	b.numClicks = 0
+	switch {
+	case n == 3 && b.tripleClickCB != nil:
+		b.tripleClickCB()
+	case n == 2 && b.doubleClickCB != nil:
+		b.doubleClickCB()
+	default:
+		for range n {
+			if b.pressedCB != nil {
+				b.pressedCB()
+			}
 		}
 	}
 }
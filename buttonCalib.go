@@ -0,0 +1,112 @@
+package tinylib
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var (
+	ErrCalibFormat   = errors.New("tinylib: bad calibration data")
+	ErrCalibMismatch = errors.New("tinylib: calibration data does not match button group")
+)
+
+// Format der Kalibrierdaten einer ButtonGroup (alle Werte little endian):
+//
+//	Header : Version (1 Byte), Anzahl Buttons (1 Byte), Aufloesung des
+//	         A/D-Wandlers in Bit (1 Byte), reserviert (1 Byte)
+//	Button : MeanValue (2 Bytes)
+//	CRC    : CRC-32 (IEEE) ueber Header und Buttons (4 Bytes)
+//
+// Die Grenzen der Buttons werden nicht gespeichert, sondern beim Import aus
+// den Messwerten berechnet (siehe ButtonGroupConfig.Margin).
+const (
+	calibVersion    = 2
+	calibHdrSize    = 4
+	calibButtonSize = 2
+	calibCRCSize    = 4
+	// Groesse eines Datenblocks mit der maximalen Anzahl von 255 Buttons.
+	calibMaxSize = calibHdrSize + calibButtonSize*255 + calibCRCSize
+)
+
+// Liefert die Kalibrierdaten aller Buttons als kompakten Datenblock, welcher
+// mit ImportCalibration wieder eingelesen werden kann.
+func (b *ButtonGroup) ExportCalibration() []byte {
+	buf := make([]byte, 0, calibHdrSize+calibButtonSize*len(b.buttonList)+calibCRCSize)
+	buf = append(buf, calibVersion, byte(len(b.buttonList)), byte(b.resolution), 0)
+	for _, br := range b.buttonList {
+		buf = binary.LittleEndian.AppendUint16(buf, br.MeanValue)
+	}
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// Uebernimmt die mit ExportCalibration erstellten Kalibrierdaten. Die
+// Buttons muessen bereits in derselben Reihenfolge mit AddButton
+// hinzugefuegt worden sein. Die Grenzen werden aus den importierten
+// Messwerten neu berechnet. Passen Anzahl Buttons oder Aufloesung nicht,
+// so wird ErrCalibMismatch retourniert, bei beschaedigten Daten
+// ErrCalibFormat und falls sich die Buttons nicht sicher unterscheiden
+// lassen ErrButtonOverlap. In all diesen Faellen bleiben die Werte
+// unveraendert.
+func (b *ButtonGroup) ImportCalibration(p []byte) error {
+	if len(p) < calibHdrSize+calibCRCSize || p[0] != calibVersion {
+		return ErrCalibFormat
+	}
+	n := int(p[1])
+	if len(p) != calibHdrSize+calibButtonSize*n+calibCRCSize {
+		return ErrCalibFormat
+	}
+	data := p[:len(p)-calibCRCSize]
+	if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(p[len(data):]) {
+		return ErrCalibFormat
+	}
+	if n != len(b.buttonList) || uint32(p[2]) != b.resolution {
+		return ErrCalibMismatch
+	}
+	data = data[calibHdrSize:]
+	old := make([]uint16, len(b.buttonList))
+	for i, br := range b.buttonList {
+		old[i] = br.MeanValue
+		br.MeanValue = binary.LittleEndian.Uint16(data[calibButtonSize*i:])
+	}
+	if err := b.updateBounds(); err != nil {
+		for i, br := range b.buttonList {
+			br.MeanValue = old[i]
+		}
+		b.updateBounds()
+		return err
+	}
+	b.tickFunc = b.workTick
+	return nil
+}
+
+// Speichert die Kalibrierdaten im Store s, bspw. im Flash:
+//
+//	err := group.SaveCalibration(tinylib.NewFlashStore(1))
+func (b *ButtonGroup) SaveCalibration(s Store) error {
+	return s.Save(b.ExportCalibration())
+}
+
+// Liest die Kalibrierdaten aus dem Store s. Ist dort nichts gespeichert, so
+// wird ErrNoData retourniert und die Buttons muessen (einmalig) mit
+// StartCalibration kalibriert werden.
+//
+//	store := tinylib.NewFlashStore(1)
+//	if err := group.LoadCalibration(store); err != nil {
+//	    group.SetOnCalibrated(func(err error) {
+//	        if err == nil {
+//	            group.SaveCalibration(store)
+//	        }
+//	    })
+//	    group.StartCalibration()
+//	}
+func (b *ButtonGroup) LoadCalibration(s Store) error {
+	// Der Puffer muss auch Daten fuer mehr Buttons aufnehmen koennen, damit
+	// ImportCalibration in diesem Fall ErrCalibMismatch liefert.
+	buf := make([]byte, calibMaxSize)
+	n, err := s.Load(buf)
+	if err != nil {
+		return err
+	}
+	return b.ImportCalibration(buf[:n])
+}
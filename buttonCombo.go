@@ -0,0 +1,82 @@
+package tinylib
+
+// Mit einer ButtonCombo werden Tastenkombinationen wie "MENU halten und UP
+// druecken" erkannt. Die Kombination wird ausgeloest, sobald alle ihre
+// Buttons gleichzeitig gedrueckt sind - unabhaengig von der Reihenfolge und
+// davon, ob die Buttons von ButtonSolo, ButtonGroup oder anderen Quellen
+// stammen. Ab diesem Moment werden bei allen beteiligten Buttons bis zu
+// ihrem Loslassen keine Hold-Events mehr erzeugt; Pressed, Klicks und
+// LongRelease entfallen ganz. Push und Release werden weiterhin gemeldet.
+//
+//	menuUp := tinylib.NewButtonCombo(&menu.Button, &up.Button)
+//	menuUp.SetOnCombo(func() { screen.Show(settings) })
+//
+// Da an einem Analog-Pin einer ButtonGroup jeweils nur ein Button erkannt
+// wird, lassen sich Buttons derselben Gruppe nicht kombinieren.
+type ButtonCombo struct {
+	buttons          []*Button
+	comboCB, resetCB ButtonCallback
+	isActive         bool
+}
+
+// Erzeugt eine neue Kombination aus den Buttons buttons.
+func NewButtonCombo(buttons ...*Button) *ButtonCombo {
+	c := &ButtonCombo{buttons: buttons}
+	for _, b := range buttons {
+		b.combos = append(b.combos, c)
+	}
+	return c
+}
+
+// Setzt cb als Callback-Handler, welcher aufgerufen wird, sobald alle
+// Buttons der Kombination gedrueckt sind.
+func (c *ButtonCombo) SetOnCombo(cb ButtonCallback) {
+	c.comboCB = cb
+}
+
+// Setzt cb als Callback-Handler, welcher nach dem Ausloesen der Kombination
+// beim Loslassen des ersten Buttons aufgerufen wird.
+func (c *ButtonCombo) SetOnRelease(cb ButtonCallback) {
+	c.resetCB = cb
+}
+
+// Liefert true, solange die Kombination gedrueckt ist.
+func (c *ButtonCombo) Active() bool {
+	return c.isActive
+}
+
+// Loest die Kombination von ihren Buttons.
+func (c *ButtonCombo) Remove() {
+	for _, b := range c.buttons {
+		for i, combo := range b.combos {
+			if combo == c {
+				b.combos = append(b.combos[:i], b.combos[i+1:]...)
+				break
+			}
+		}
+	}
+	c.buttons = nil
+	c.isActive = false
+}
+
+func (c *ButtonCombo) update() {
+	allDown := len(c.buttons) > 0
+	for _, b := range c.buttons {
+		allDown = allDown && b.IsDown()
+	}
+	switch {
+	case allDown && !c.isActive:
+		c.isActive = true
+		for _, b := range c.buttons {
+			b.inCombo = true
+		}
+		if c.comboCB != nil {
+			c.comboCB()
+		}
+	case !allDown && c.isActive:
+		c.isActive = false
+		if c.resetCB != nil {
+			c.resetCB()
+		}
+	}
+}
@@ -1,12 +1,14 @@
 package tinylib
 
 import (
+	"errors"
 	"machine"
+	"sort"
 	"time"
 )
 
 const (
-	defValueEpsilon    = 30
+	defButtonMargin    = 16
 	defNumCalibSamples = 200
 	defButtonsPollRate = 10 * time.Millisecond
 	defADCResolution   = 12
@@ -17,6 +19,20 @@ var (
 	defADCMaxValue   uint16
 )
 
+var (
+	ErrButtonOverlap = errors.New("tinylib: analog buttons too close together")
+)
+
+// Wird AddButton mit diesem Messwert aufgerufen, so gilt der Button als
+// noch nicht kalibriert. Er wird erst nach StartCalibration oder
+// ImportCalibration erkannt und bei der Pruefung auf Ueberschneidungen
+// nicht beruecksichtigt.
+const ButtonUncalibrated uint16 = 0xFFFF
+
+// Funktionstyp fuer den Callback, welcher nach Abschluss der Kalibrierung
+// aufgerufen wird. err ist nil oder ErrButtonOverlap.
+type CalibrationCallback func(err error)
+
 // Enthaelt alle wichtigen Konfigurationseinstellungen zu einer Reihe von
 // Buttons, welche über einen einzigen Analog-Pin gefuehrt werden. Die Wahl
 // der für jedem Button eigenen Widerstandswerte ist so zu wählen, dass die
@@ -25,6 +41,13 @@ type ButtonGroupConfig struct {
 	// Intervall, in welchem der Zustand des Buttons abgefragt werden soll.
 	PollRate   time.Duration
 	Resolution uint32
+	// Die Grenzen zwischen zwei Buttons liegen in der Mitte zwischen ihren
+	// Messwerten. Messwerte, welche um weniger als Margin von einer Grenze
+	// entfernt liegen, werden keinem Button zugeordnet (Default: 16, in
+	// Einheiten des A/D-Wandlers bei der gewaehlten Aufloesung). Die
+	// Messwerte zweier Buttons muessen sich daher um mehr als 2*Margin
+	// unterscheiden, ebenso der Messwert jedes Buttons vom Ruhepegel.
+	Margin uint16
 }
 
 // Mit diesem Typ wird ein Button mit dem Intervall eines analogen Signals
@@ -35,7 +58,9 @@ type AnalogButtonReadout struct {
 }
 
 // Mit diesem Typ koennen Push-Buttons auf vielfaeltige Weise angesteuert
-// werden. Wichtig: die Entprellung des Buttons muss hardwareseitig erfolgen!
+// werden. Die Entprellung erfolgt ueber die Konfiguration der einzelnen
+// Buttons (ButtonConfig.Debounce). Sie unterdrueckt auch kurze Treffer
+// anderer Buttons, welche beim Wechsel des Messwerts entstehen koennen.
 // Es gibt 4 Events, fuer welche entsprechende Callbacks hinterlegt werden
 // koennen.
 //
@@ -50,9 +75,12 @@ type ButtonGroup struct {
 	Pin        machine.Pin
 	adc        machine.ADC
 	pollRate   time.Duration
+	resolution uint32
+	margin     uint16
 	lastId     int
 	buttonList []*AnalogButtonReadout
 	tickFunc   func()
+	calibCB    CalibrationCallback
 
     // Das sind die Variablen, welche waehrend der Kalibrierung der Buttons
     // verwendet werden. Stellt sich die Frage, ob und wie man die in einen
@@ -82,6 +110,11 @@ func (b *ButtonGroup) Configure(cfg ButtonGroupConfig) {
 		Resolution: cfg.Resolution,
 	})
 	b.pollRate = cfg.PollRate
+	b.resolution = cfg.Resolution
+	if cfg.Margin == 0 {
+		cfg.Margin = defButtonMargin
+	}
+	b.margin = cfg.Margin
 	b.lastId = -1
 	b.buttonList = make([]*AnalogButtonReadout, 0)
 	b.tickFunc = b.workTick
@@ -91,15 +124,76 @@ func (b *ButtonGroup) Configure(cfg ButtonGroupConfig) {
 // des Buttons innerhalb der Gruppe angegeben, wobei die Buttons lueckenlos
 // von 0 bis numButtons-1 durchnumeriert werden. val ist der Messwert des
 // A/D-Wandlers, der beim Druecken dieses Buttons erwartet wird und btn
-// schliesslich ein Pointer auf den Button.
-func (b *ButtonGroup) AddButton(btn *Button, val uint16) {
+// schliesslich ein Pointer auf den Button. Ist val noch nicht bekannt (weil
+// die Buttons erst kalibriert oder die Kalibrierdaten geladen werden), so
+// ist ButtonUncalibrated anzugeben. Liegt val zu nahe beim Messwert eines
+// bereits vorhandenen Buttons oder beim Ruhepegel (siehe
+// ButtonGroupConfig.Margin), so wird der Button nicht hinzugefuegt und
+// ErrButtonOverlap retourniert.
+func (b *ButtonGroup) AddButton(btn *Button, val uint16) error {
 	br := &AnalogButtonReadout{
-		MeanValue:  val,
-		LowerBound: val - defValueEpsilon,
-		UpperBound: val + defValueEpsilon,
-		Button:     btn,
+		MeanValue: val,
+		Button:    btn,
 	}
 	b.buttonList = append(b.buttonList, br)
+	if val == ButtonUncalibrated {
+		return nil
+	}
+	if err := b.updateBounds(); err != nil {
+		b.buttonList = b.buttonList[:len(b.buttonList)-1]
+		b.updateBounds()
+		return err
+	}
+	return nil
+}
+
+// Berechnet die Grenzen aller Buttons aus den Mittelpunkten zwischen den
+// Messwerten benachbarter Buttons. Der oberste Button grenzt an den
+// Ruhepegel, der unterste reicht bis 0. Noch nicht kalibrierte Buttons
+// erhalten einen leeren Bereich. Liefert ErrButtonOverlap, falls zwei
+// Buttons nicht sicher unterschieden werden koennen. Die Bereiche
+// ueberlappen sich aber auch in diesem Fall nicht.
+func (b *ButtonGroup) updateBounds() error {
+	var err error
+
+	sorted := make([]*AnalogButtonReadout, 0, len(b.buttonList))
+	for _, br := range b.buttonList {
+		if br.MeanValue == ButtonUncalibrated {
+			br.LowerBound, br.UpperBound = 0, 0
+			continue
+		}
+		sorted = append(sorted, br)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].MeanValue < sorted[j].MeanValue
+	})
+	margin := int(b.margin)
+	lower := 0
+	for i, br := range sorted {
+		mean := int(br.MeanValue)
+		next := int(defADCMaxValue)
+		if i+1 < len(sorted) {
+			next = int(sorted[i+1].MeanValue)
+		}
+		if next-mean <= 2*margin && err == nil {
+			err = ErrButtonOverlap
+		}
+		mid := (mean + next) / 2
+		upper := max(mid-margin, lower)
+		br.LowerBound = uint16(lower)
+		br.UpperBound = uint16(upper)
+		lower = max(mid+margin, upper)
+	}
+	return err
+}
+
+// Setzt cb als Callback-Handler, welcher nach Abschluss der Kalibrierung
+// aufgerufen wird, bspw. um die Daten mit SaveCalibration zu speichern.
+// Koennen nicht alle Buttons sicher unterschieden werden, so wird cb mit
+// ErrButtonOverlap aufgerufen; die Buttons bleiben dann inaktiv, bis sie
+// erneut kalibriert oder gueltige Daten importiert werden.
+func (b *ButtonGroup) SetOnCalibrated(cb CalibrationCallback) {
+	b.calibCB = cb
 }
 
 func (b *ButtonGroup) StartCalibration() {
@@ -112,7 +206,16 @@ func (b *ButtonGroup) StartCalibration() {
 // mit id=0 und durchlaeuft alle Buttons der Reihe nach.
 func (b *ButtonGroup) calibrate(id int) {
 	if id >= len(b.buttonList) {
-		b.tickFunc = b.workTick
+		err := b.updateBounds()
+		if err != nil {
+			println("  error: some buttons can't be distinguished")
+			b.tickFunc = b.idleTick
+		} else {
+			b.tickFunc = b.workTick
+		}
+		if b.calibCB != nil {
+			b.calibCB(err)
+		}
 		return
 	}
 	println(">> press button", id, "and hold it!")
@@ -128,7 +231,10 @@ func (b *ButtonGroup) calibrate(id int) {
 // Retourniert einen Task, welcher bei einem Dispatcher hinterlegt werden
 // kann und alle btnPollRate Millisekunden aufgerufen werden muss (sollte).
 func (b *ButtonGroup) Task() *Task {
-	return NewTask(b.Tick, TaskConfig{Interval: b.pollRate})
+	return NewTask(b.Tick, TaskConfig{
+		Interval: b.pollRate,
+		Mode:     FixedRate,
+	})
 }
 
 func (b *ButtonGroup) Tick() {
@@ -146,8 +252,6 @@ func (b *ButtonGroup) calibTick() {
 			println("    max:", b.maxValue)
 			println("  data has been updated")
 			b.buttonList[b.buttonToCalibrate].MeanValue = avg
-			b.buttonList[b.buttonToCalibrate].LowerBound = avg - defValueEpsilon
-			b.buttonList[b.buttonToCalibrate].UpperBound = avg + defValueEpsilon
 			b.calibrate(b.buttonToCalibrate + 1)
 		}
 		return
@@ -169,6 +273,10 @@ func (b *ButtonGroup) calibTick() {
 	}
 }
 
+// Wird nach einer misslungenen Kalibrierung verwendet: die Buttons werden
+// nicht abgefragt.
+func (b *ButtonGroup) idleTick() {}
+
 // In dieser Methode steckt die ganze Logik hinter dem Button. Diese Methode
 // kann entweder direkt alle btnPollRate Millisekunden aufgerufen werden
 // oder durch einen Task (siehe Methode Task()).
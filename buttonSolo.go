@@ -53,7 +53,10 @@ func (b *ButtonSolo) Configure(cfg ButtonSoloConfig) {
 // Retourniert einen Task, welcher bei einem Dispatcher hinterlegt werden
 // kann und alle btnPollRate Millisekunden aufgerufen werden muss (sollte).
 func (b *ButtonSolo) Task() *Task {
-	return NewTask(b.Tick, TaskConfig{Interval: b.pollRate})
+	return NewTask(b.Tick, TaskConfig{
+		Interval: b.pollRate,
+		Mode:     FixedRate,
+	})
 }
 
 // Mit dieser Methode kann man einen ButtonSolo periodisch als Task durch den
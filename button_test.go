@@ -0,0 +1,157 @@
+package tinylib
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Abstand der Samples in den Mustern von drive.
+const testButtonTick = 10 * time.Millisecond
+
+// Fuehrt den Buttons bs die Samples in den Mustern patterns zu, je eines
+// pro testButtonTick: '#' steht fuer gedrueckt, '.' fuer losgelassen.
+// Kuerzere Muster werden mit '.' aufgefuellt.
+func drive(bs []*Button, patterns ...string) {
+	n := 0
+	for _, p := range patterns {
+		n = max(n, len(p))
+	}
+	t0 := time.Unix(0, 0)
+	for i := range n {
+		now := t0.Add(time.Duration(i) * testButtonTick)
+		for j, b := range bs {
+			b.process(i < len(patterns[j]) && patterns[j][i] == '#', now)
+		}
+	}
+}
+
+// Haengt alle Events des Buttons b als Zeichen an log an: 'v' Push, '^'
+// Release, 'p' Pressed, 'h' Hold, 'L' LongRelease, 'D' DoubleClick und 'T'
+// TripleClick. Die Callbacks fuer Doppel- und Dreifachklicks werden nur
+// bei double bzw. triple gesetzt.
+func record(b *Button, log *strings.Builder, prefix string, double, triple bool) {
+	ev := func(c string) ButtonCallback {
+		return func() { log.WriteString(prefix + c) }
+	}
+	b.SetOnPush(ev("v"))
+	b.SetOnRelease(ev("^"))
+	b.SetOnPressed(ev("p"))
+	b.SetOnHold(func(bool) { log.WriteString(prefix + "h") })
+	b.SetOnLongRelease(ev("L"))
+	if double {
+		b.SetOnDoubleClick(ev("D"))
+	}
+	if triple {
+		b.SetOnTripleClick(ev("T"))
+	}
+}
+
+func TestButtonClicks(t *testing.T) {
+	dots := strings.Repeat(".", 40)
+	tests := []struct {
+		name           string
+		double, triple bool
+		pattern        string
+		want           string
+	}{
+		{"single", false, false, "###...", "v^p"},
+		{"single pending", true, false, "###.....", "v^"},
+		{"single late", true, false, "###" + dots, "v^p"},
+		{"double", true, false, "###.....###" + dots, "v^v^D"},
+		{"double window expired", true, false, "###" + dots + "###" + dots, "v^pv^p"},
+		{"double then single", true, false, "###..###..###" + dots, "v^v^Dv^p"},
+		{"double without callback", false, false, "###..###" + dots, "v^pv^p"},
+		{"triple", true, true, "###..###..###" + dots, "v^v^v^T"},
+		{"triple pending", true, true, "###..###.....", "v^v^"},
+		{"double with triple callback", true, true, "###..###" + dots, "v^v^D"},
+		{"long release", true, false, strings.Repeat("#", 60) + ".", "vh^L"},
+		{"click then hold", true, false, "###.." + strings.Repeat("#", 60), "v^vph"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var b Button
+			b.Configure(ButtonConfig{})
+			var log strings.Builder
+			record(&b, &log, "", tc.double, tc.triple)
+			drive([]*Button{&b}, tc.pattern)
+			if got := log.String(); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestButtonDebounce(t *testing.T) {
+	const pattern = "#.#.#.######......"
+	tests := []struct {
+		cfg  DebounceConfig
+		want string
+	}{
+		{DebounceConfig{Mode: DebounceNone}, "v^pv^pv^pv^p"},
+		{DebounceConfig{Mode: DebounceStable, Time: 30 * time.Millisecond}, "v^p"},
+		{DebounceConfig{Mode: DebounceIntegrator, Samples: 3}, "v^p"},
+		{DebounceConfig{Mode: DebounceCounter, Samples: 3}, "v^p"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.cfg.Mode.String(), func(t *testing.T) {
+			var b Button
+			b.Configure(ButtonConfig{Debounce: tc.cfg})
+			var log strings.Builder
+			record(&b, &log, "", false, false)
+			drive([]*Button{&b}, pattern)
+			if got := log.String(); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestButtonCombo(t *testing.T) {
+	var a, b Button
+	a.Configure(ButtonConfig{})
+	b.Configure(ButtonConfig{})
+	var log strings.Builder
+	record(&a, &log, "a", true, false)
+	record(&b, &log, "b", true, false)
+	combo := NewButtonCombo(&a, &b)
+	combo.SetOnCombo(func() { log.WriteString("C") })
+	combo.SetOnRelease(func() { log.WriteString("R") })
+	drive([]*Button{&a, &b},
+		strings.Repeat("#", 80)+strings.Repeat(".", 40),
+		strings.Repeat(".", 10)+strings.Repeat("#", 10))
+	if got, want := log.String(), "avbvCb^Ra^"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestHoldAccelRamp(t *testing.T) {
+	var b Button
+	b.Configure(ButtonConfig{
+		HoldThreshold: 500 * time.Millisecond,
+		HoldCallRate:  100 * time.Millisecond,
+		HoldAccel: []HoldStage{
+			{After: 3, Rate: 50 * time.Millisecond},
+			{After: 6, Steps: 5},
+		},
+	})
+	var steps []int
+	b.SetOnHoldSteps(func(first bool, n int) { steps = append(steps, n) })
+	t0 := time.Unix(0, 0)
+	var times []time.Duration
+	for i := range 150 {
+		n := len(steps)
+		now := t0.Add(time.Duration(i) * 10 * time.Millisecond)
+		b.process(true, now)
+		if len(steps) != n {
+			times = append(times, now.Sub(t0)/time.Millisecond)
+		}
+	}
+	wantTimes := []time.Duration{500, 600, 700, 800, 850, 900, 950, 1000, 1050}
+	wantSteps := []int{1, 1, 1, 1, 1, 1, 1, 5, 5}
+	for i := range wantTimes {
+		if times[i] != wantTimes[i] || steps[i] != wantSteps[i] {
+			t.Fatalf("hold events at %v ms with steps %v", times, steps)
+		}
+	}
+}
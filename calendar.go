@@ -0,0 +1,321 @@
+package tinylib
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mit Kalender-Tasks koennen Funktionen zu bestimmten Uhrzeiten ausgefuehrt
+// werden (Wecker, naechtlicher Sendersuchlauf, stuendliche Nachrichten,
+// etc.). Massgebend ist dabei die Zeit einer WallClock, nicht die Uhr des
+// Dispatchers. Die Termine werden entweder als Cron-Ausdruck oder direkt als
+// CalendarSpec angegeben:
+//
+//	wall := tinylib.NewWallClock(tinylib.Disp.Clock())
+//	alarm, err := tinylib.Disp.Cron("30 6 * * mon-fri", wall, radio.WakeUp)
+//	scan := tinylib.NewCalendarTask(dab.StartFullScan,
+//	    tinylib.DailyAt(3, 0), wall, tinylib.TaskConfig{Name: "scan"})
+//	tinylib.Disp.AddTask(scan)
+
+var (
+	ErrBadCronSpec = errors.New("tinylib: bad cron expression")
+	ErrCronNever   = errors.New("tinylib: cron expression never matches")
+)
+
+const (
+	// So lange schlaeft ein Kalender-Task hoechstens, damit ein Stellen der
+	// Wanduhr rechtzeitig bemerkt wird.
+	calendarMaxSleep = 30 * time.Second
+	// Um hoechstens so viel darf ein Termin verspaetet ausgefuehrt werden.
+	// Wird die Wanduhr weiter vorgestellt, so wird der Termin ausgelassen.
+	calendarTolerance = time.Minute
+)
+
+// Beschreibt die Termine eines Kalender-Tasks als Bitmasken, analog zu den
+// fuenf Feldern eines Cron-Ausdrucks. Bit i entspricht jeweils dem Wert i,
+// bei Weekdays ist Bit 0 der Sonntag (siehe time.Weekday). Eine leere Maske
+// steht fuer "jeder Wert". Sind sowohl Days als auch Weekdays gesetzt, so
+// genuegt es, wenn eines der beiden Felder passt (wie bei Cron).
+type CalendarSpec struct {
+	Minutes  uint64
+	Hours    uint32
+	Days     uint32
+	Months   uint16
+	Weekdays uint8
+}
+
+// Liefert einen Termin, welcher taeglich (bzw. nur an den Wochentagen days)
+// um hour:minute faellig ist. Liegen hour, minute oder einer der Wochentage
+// ausserhalb ihres Wertebereichs, so wird eine Panic ausgeloest, da es sich
+// um einen Programmierfehler handelt.
+func DailyAt(hour, minute int, days ...time.Weekday) CalendarSpec {
+	if hour < 0 || hour > 23 {
+		panic("tinylib: DailyAt: hour out of range")
+	}
+	s := HourlyAt(minute)
+	s.Hours = 1 << hour
+	for _, day := range days {
+		if day < time.Sunday || day > time.Saturday {
+			panic("tinylib: DailyAt: weekday out of range")
+		}
+		s.Weekdays |= 1 << day
+	}
+	return s
+}
+
+// Liefert einen Termin, welcher zu jeder vollen Stunde plus minute faellig
+// ist. Liegt minute nicht im Bereich 0..59, so wird eine Panic ausgeloest.
+func HourlyAt(minute int) CalendarSpec {
+	if minute < 0 || minute > 59 {
+		panic("tinylib: HourlyAt: minute out of range")
+	}
+	return CalendarSpec{Minutes: 1 << minute}
+}
+
+// Wandelt einen Cron-Ausdruck mit den fuenf Feldern Minute, Stunde, Tag,
+// Monat und Wochentag in einen Termin um. Unterstuetzt werden '*', Listen
+// ("1,15"), Bereiche ("1-5"), Schrittweiten ("*/15", "8-18/2"), englische
+// Kuerzel fuer Monate und Wochentage ("jan", "mon") sowie die Kurzformen
+// @yearly, @monthly, @weekly, @daily und @hourly. Beim Wochentag ist 7
+// gleichbedeutend mit 0 (Sonntag).
+func ParseCron(expr string) (CalendarSpec, error) {
+	switch expr {
+	case "@yearly", "@annually":
+		expr = "0 0 1 1 *"
+	case "@monthly":
+		expr = "0 0 1 * *"
+	case "@weekly":
+		expr = "0 0 * * 0"
+	case "@daily", "@midnight":
+		expr = "0 0 * * *"
+	case "@hourly":
+		expr = "0 * * * *"
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return CalendarSpec{}, ErrBadCronSpec
+	}
+	var masks [5]uint64
+	for i, field := range fields {
+		mask, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return CalendarSpec{}, err
+		}
+		masks[i] = mask
+	}
+	if masks[4]&(1<<7) != 0 {
+		masks[4] = (masks[4] | 1) &^ (1 << 7)
+	}
+	return CalendarSpec{
+		Minutes:  masks[0],
+		Hours:    uint32(masks[1]),
+		Days:     uint32(masks[2]),
+		Months:   uint16(masks[3]),
+		Weekdays: uint8(masks[4]),
+	}, nil
+}
+
+// Wertebereich und (optionale) Namen eines Feldes in einem Cron-Ausdruck.
+type cronField struct {
+	min, max int
+	names    []string
+}
+
+var cronFields = [5]cronField{
+	{0, 59, nil},
+	{0, 23, nil},
+	{1, 31, nil},
+	{1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul",
+		"aug", "sep", "oct", "nov", "dec"}},
+	{0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Wandelt ein Feld eines Cron-Ausdrucks in eine Bitmaske um. Ein einzelnes
+// '*' ergibt die leere Maske.
+func parseCronField(s string, f cronField) (uint64, error) {
+	if s == "*" {
+		return 0, nil
+	}
+	mask := uint64(0)
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, ErrBadCronSpec
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := f.min, f.max
+		if part != "*" {
+			var err error
+			i := strings.IndexByte(part, '-')
+			if i < 0 {
+				if lo, err = f.value(part); err != nil {
+					return 0, err
+				}
+				if step == 1 {
+					hi = lo
+				}
+			} else {
+				if lo, err = f.value(part[:i]); err != nil {
+					return 0, err
+				}
+				if hi, err = f.value(part[i+1:]); err != nil {
+					return 0, err
+				}
+			}
+		}
+		if lo > hi {
+			return 0, ErrBadCronSpec
+		}
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << v
+		}
+	}
+	return mask, nil
+}
+
+// Liefert den Wert einer Zahl oder eines Namens in diesem Feld.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, ErrBadCronSpec
+	}
+	return v, nil
+}
+
+// Liefert den ersten Termin nach dem Zeitpunkt after (in dessen Zeitzone).
+// Gibt es innerhalb der naechsten fuenf Jahre keinen Termin (bspw. beim
+// 30. Februar), so wird die Nullzeit retourniert.
+func (s CalendarSpec) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		y, m, d := t.Date()
+		switch {
+		case !s.matchMonth(m):
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchDay(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case s.Hours != 0 && s.Hours&(1<<t.Hour()) == 0:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+		case s.Minutes != 0 && s.Minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s CalendarSpec) matchMonth(m time.Month) bool {
+	return s.Months == 0 || s.Months&(1<<m) != 0
+}
+
+func (s CalendarSpec) matchDay(t time.Time) bool {
+	day := s.Days&(1<<t.Day()) != 0
+	weekday := s.Weekdays&(1<<t.Weekday()) != 0
+	switch {
+	case s.Days == 0 && s.Weekdays == 0:
+		return true
+	case s.Days == 0:
+		return weekday
+	case s.Weekdays == 0:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+//----------------------------------------------------------------------------
+
+// Zustand eines Kalender-Tasks.
+type calendarJob struct {
+	fnc   TaskFunc
+	spec  CalendarSpec
+	clock *WallClock
+	// Anzahl Aufrufe von WallClock.Set bei der letzten Berechnung von next.
+	numSets uint32
+	// Naechster und zuletzt ausgefuehrter Termin.
+	next, fired time.Time
+}
+
+// Erzeugt einen Task, welcher fnc zu den Terminen in spec ausfuehrt. Die
+// Termine werden gegen die Wanduhr clock geprueft; solange diese nicht
+// gestellt ist, wird fnc nie ausgefuehrt. Der Task wacht mindestens alle
+// 30 Sekunden auf und berechnet nach jedem Stellen der Uhr den naechsten
+// Termin ab der neu gestellten Zeit:
+//
+//   - Termine, welche hoechstens eine Minute vor der neuen Zeit liegen,
+//     werden noch ausgefuehrt, aeltere werden ausgelassen.
+//   - Wird die Uhr um mehr als eine Minute zurueckgestellt, so werden die
+//     Termine ab der neuen Zeit nochmals ausgefuehrt. Kleinere Korrekturen
+//     fuehren nicht dazu, dass ein Termin doppelt ausgefuehrt wird.
+//
+// Interval in cfg bestimmt den Zeitpunkt der ersten Pruefung.
+func NewCalendarTask(fnc TaskFunc, spec CalendarSpec, clock *WallClock, cfg TaskConfig) *Task {
+	job := &calendarJob{fnc: fnc, spec: spec, clock: clock}
+	return NewAdaptiveTask(job.run, cfg)
+}
+
+// Fuehrt fnc zu den Terminen des Cron-Ausdrucks spec aus (siehe ParseCron
+// und NewCalendarTask). Ist spec zwar gueltig, hat aber nie einen Termin
+// (bspw. "0 0 31 2 *"), so wird ErrCronNever retourniert.
+func (d *Dispatcher) Cron(spec string, clock *WallClock, fnc TaskFunc) (*Task, error) {
+	cs, err := ParseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	if cs.Next(clock.Now()).IsZero() {
+		return nil, ErrCronNever
+	}
+	task := NewCalendarTask(fnc, cs, clock, TaskConfig{Name: spec})
+	d.AddTask(task)
+	return task, nil
+}
+
+func (j *calendarJob) run() time.Duration {
+	c := j.clock
+	if !c.IsSet() {
+		return calendarMaxSleep
+	}
+	if j.numSets != c.numSets {
+		j.numSets = c.numSets
+		from := c.setTime.Add(-calendarTolerance)
+		if j.fired.After(from) && j.fired.Sub(c.setTime) < calendarTolerance {
+			from = j.fired
+		}
+		j.next = j.spec.Next(from)
+	}
+	now := c.Now()
+	if !j.next.IsZero() && !now.Before(j.next) {
+		due := j.next
+		if c.setTime.After(due) {
+			due = c.setTime
+		}
+		if now.Sub(due) < calendarTolerance {
+			j.fired = j.next
+			j.fnc()
+			now = c.Now()
+		}
+		j.next = j.spec.Next(now)
+	}
+	if j.next.IsZero() {
+		return StopTask
+	}
+	sleep := j.next.Sub(now)
+	if sleep > calendarMaxSleep {
+		sleep = calendarMaxSleep
+	}
+	return (sleep + time.Millisecond - 1) / time.Millisecond * time.Millisecond
+}
@@ -0,0 +1,39 @@
+package tinylib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNever(t *testing.T) {
+	d := NewDispatcher()
+	wall := NewWallClock(NewVirtualClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+	if _, err := d.Cron("0 0 31 2 *", wall, func() {}); err != ErrCronNever {
+		t.Fatalf("got %v, want ErrCronNever", err)
+	}
+	if _, err := d.Cron("0 0 29 2 *", wall, func() {}); err != nil {
+		t.Fatalf("leap day: %v", err)
+	}
+}
+
+func TestDailyAtRange(t *testing.T) {
+	for _, fn := range []func(){
+		func() { DailyAt(24, 0) },
+		func() { DailyAt(6, 60) },
+		func() { DailyAt(6, 0, 7) },
+		func() { HourlyAt(-1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("out of range argument accepted")
+				}
+			}()
+			fn()
+		}()
+	}
+	s := DailyAt(6, 30, time.Monday)
+	if s.Hours != 1<<6 || s.Minutes != 1<<30 || s.Weekdays != 1<<time.Monday {
+		t.Fatalf("bad spec %+v", s)
+	}
+}
@@ -0,0 +1,132 @@
+package tinylib
+
+import (
+	"time"
+)
+
+// Ueber dieses Interface bezieht ein Dispatcher die aktuelle Zeit. Damit
+// laesst sich das Scheduling von der realen Uhr entkoppeln und bspw. auf
+// einem Linux-Host oder in einer deterministischen Simulation mit virtueller
+// Zeit testen.
+type Clock interface {
+	Now() time.Time
+}
+
+// Die Systemuhr ist die Standard-Zeitquelle jedes Dispatchers und liefert
+// einfach die aktuelle Zeit von time.Now().
+type SystemClock struct{}
+
+func (c SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+//----------------------------------------------------------------------------
+
+// Alles, was von einer virtuellen Uhr angetrieben werden kann - typischer-
+// weise ein Dispatcher.
+type Scheduler interface {
+	Tick() time.Duration
+	NextExecTime() (time.Time, bool)
+}
+
+// Eine virtuelle Uhr, deren Zeit nur explizit (durch Set, Advance oder
+// RunUntil) veraendert wird. Damit koennen Task-Graphen ohne echtes Warten
+// durchgespielt werden:
+//
+//	clk := tinylib.NewVirtualClock(time.Unix(0, 0))
+//	disp := tinylib.NewDispatcher()
+//	disp.SetClock(clk)
+//	disp.AddTask(ledTask)
+//	clk.RunUntil(clk.Now().Add(10*time.Second), disp)
+type VirtualClock struct {
+	now time.Time
+}
+
+// Erzeugt eine neue virtuelle Uhr, welche auf den Zeitpunkt start gestellt
+// ist.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	return c.now
+}
+
+// Stellt die Uhr auf den Zeitpunkt t. Es sind auch Spruenge in die
+// Vergangenheit moeglich.
+func (c *VirtualClock) Set(t time.Time) {
+	c.now = t
+}
+
+// Stellt die Uhr um die Dauer d vor.
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// Laesst die Uhr bis zum Zeitpunkt t laufen. Dabei wird die Zeit jeweils
+// direkt auf den naechsten Ausfuehrungszeitpunkt von s gestellt und s.Tick()
+// aufgerufen. Da der Dispatcher mit Millisekunden rechnet (siehe
+// Dispatcher.Now), wird dieser Zeitpunkt auf die naechste ganze Milli-
+// sekunde aufgerundet. Am Ende steht die Uhr auf t.
+func (c *VirtualClock) RunUntil(t time.Time, s Scheduler) {
+	for {
+		s.Tick()
+		next, ok := s.NextExecTime()
+		if !ok || next.After(t) {
+			break
+		}
+		if rest := next.Sub(next.Truncate(time.Millisecond)); rest > 0 {
+			next = next.Add(time.Millisecond - rest)
+		}
+		if next.After(c.now) {
+			c.now = next
+		}
+	}
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+//----------------------------------------------------------------------------
+
+// Eine stellbare Uhr fuer Datum und Uhrzeit (Wanduhr). Sie laeuft mit ihrer
+// Basisuhr (typischerweise der Uhr des Dispatchers) mit und kann jederzeit
+// neu gestellt werden, bspw. mit der Zeit aus dem DAB-Signal:
+//
+//	wall := tinylib.NewWallClock(tinylib.Disp.Clock())
+//	tinylib.Disp.AddTask(tinylib.NewTask(func() {
+//	    wall.Set(dab.Time())
+//	}, tinylib.TaskConfig{Interval: time.Hour}))
+//
+// Sie dient als Zeitbasis fuer Kalender-Tasks (siehe NewCalendarTask).
+type WallClock struct {
+	base    Clock
+	offset  time.Duration
+	loc     *time.Location
+	setTime time.Time
+	numSets uint32
+}
+
+// Erzeugt eine neue Wanduhr, welche mit der Uhr base mitlaeuft. Bis zum
+// ersten Aufruf von Set liefert sie die Zeit von base.
+func NewWallClock(base Clock) *WallClock {
+	return &WallClock{base: base, loc: time.Local}
+}
+
+func (c *WallClock) Now() time.Time {
+	return c.base.Now().Add(c.offset).In(c.loc)
+}
+
+// Stellt die Uhr auf den Zeitpunkt t. Die Zeitzone von t wird fuer alle
+// weiteren Zeitangaben dieser Uhr uebernommen.
+func (c *WallClock) Set(t time.Time) {
+	c.offset = t.Sub(c.base.Now())
+	c.loc = t.Location()
+	c.setTime = t
+	c.numSets += 1
+}
+
+// Liefert true, falls die Uhr bereits mit Set gestellt wurde.
+func (c *WallClock) IsSet() bool {
+	return c.numSets > 0
+}
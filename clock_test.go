@@ -0,0 +1,77 @@
+//go:build inline
+
+package tinylib
+
+import (
+	"testing"
+	"time"
+)
+
+// Liefert einen Dispatcher, welcher von einer virtuellen Uhr angetrieben
+// wird.
+func newTestDispatcher() (*Dispatcher, *VirtualClock) {
+	clk := NewVirtualClock(time.Unix(1000, 0))
+	d := NewDispatcher()
+	d.SetClock(clk)
+	return d, clk
+}
+
+func TestVirtualClockRunUntil(t *testing.T) {
+	d, clk := newTestDispatcher()
+	start := clk.Now()
+	var runs []time.Duration
+	d.Every(100*time.Millisecond, func() {
+		runs = append(runs, clk.Now().Sub(start))
+	})
+	clk.RunUntil(start.Add(time.Second), d)
+	if len(runs) != 10 {
+		t.Fatalf("got %d runs, want 10", len(runs))
+	}
+	for i, r := range runs {
+		if want := time.Duration(i+1) * 100 * time.Millisecond; r != want {
+			t.Errorf("run %d at %v, want %v", i, r, want)
+		}
+	}
+	if !clk.Now().Equal(start.Add(time.Second)) {
+		t.Errorf("clock at %v, want %v", clk.Now(), start.Add(time.Second))
+	}
+}
+
+func TestVirtualClockSubMillisecond(t *testing.T) {
+	d, clk := newTestDispatcher()
+	start := clk.Now()
+	var at time.Duration
+	d.At(start.Add(1500*time.Microsecond), func() {
+		at = clk.Now().Sub(start)
+	})
+	numCalls := 0
+	d.Every(500*time.Microsecond, func() {
+		numCalls++
+	})
+	clk.RunUntil(start.Add(10*time.Millisecond), d)
+	if at != 2*time.Millisecond {
+		t.Errorf("one-shot ran at %v, want 2ms", at)
+	}
+	if numCalls == 0 {
+		t.Error("periodic task with sub-millisecond interval never ran")
+	}
+}
+
+func TestLoadMeter(t *testing.T) {
+	var m loadMeter
+	// 10% Last waehrend eines ganzen Fensters.
+	for ms := int64(0); ms < loadMeasureLengthMS; ms += 100 {
+		m.add(ms, 10*time.Millisecond)
+	}
+	if l := m.load(loadMeasureLengthMS - 1); l != 10 {
+		t.Errorf("load %d%%, want 10%%", l)
+	}
+	// Nach 11 Slots ohne Last sind noch 14 von 25 Slots uebrig (5.6%).
+	if l := m.load(loadMeasureLengthMS + 10*loadSlotLengthMS); l != 5 {
+		t.Errorf("load %d%%, want 5%%", l)
+	}
+	// Nach einem ganzen Fenster ohne Last ist nichts mehr uebrig.
+	if l := m.load(3 * loadMeasureLengthMS); l != 0 {
+		t.Errorf("load %d%%, want 0%%", l)
+	}
+}
@@ -0,0 +1,64 @@
+// Wandelt eine mit tinylib.Tracer erstellte Aufzeichnung auf dem Host in
+// das Format trace_event von Chrome (Perfetto) oder in einen Value Change
+// Dump (GTKWave) um:
+//
+//	tracedump -f chrome -o radio.json radio.trace
+//	tracedump -f vcd radio.trace > radio.vcd
+//
+// Ohne Dateiname wird die Aufzeichnung von der Standardeingabe gelesen.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"tinylib/trace"
+)
+
+func main() {
+	format := flag.String("f", "chrome", "output format: chrome or vcd")
+	outFile := flag.String("o", "", "output file (default: stdout)")
+	flag.Parse()
+
+	var in io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		fh, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fail(err)
+		}
+		defer fh.Close()
+		in = fh
+	}
+	t, err := trace.Decode(in)
+	if err != nil {
+		fail(err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *outFile != "" {
+		fh, err := os.Create(*outFile)
+		if err != nil {
+			fail(err)
+		}
+		defer fh.Close()
+		out = fh
+	}
+	switch *format {
+	case "chrome":
+		err = t.WriteChrome(out)
+	case "vcd":
+		err = t.WriteVCD(out)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "tracedump:", err)
+	os.Exit(1)
+}
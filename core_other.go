@@ -0,0 +1,10 @@
+//go:build inline && !rp2040 && !rp2350
+
+package tinylib
+
+// Anzahl der Prozessorkerne.
+const NumCores = 1
+
+func currentCore() int {
+	return 0
+}
@@ -0,0 +1,14 @@
+//go:build inline && (rp2040 || rp2350)
+
+package tinylib
+
+import (
+	"machine"
+)
+
+// Anzahl der Prozessorkerne.
+const NumCores = 2
+
+func currentCore() int {
+	return int(machine.CurrentCore())
+}
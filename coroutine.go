@@ -0,0 +1,173 @@
+package tinylib
+
+import (
+	"time"
+)
+
+// Mit Koroutinen lassen sich mehrstufige Ablaeufe (Kalibrierung, Wieder-
+// holungsschleifen bei der Ansteuerung eines Chips, etc.) ohne eigene
+// Zustandsmaschine und ohne blockierende Warteschleifen formulieren. Eine
+// Koroutine besteht aus nummerierten Schritten; die Schrittfunktion wird
+// mit der Koroutine aufgerufen und fuehrt mit einem switch auf Step() den
+// aktuellen Schritt aus. Am Ende des Schrittes legt sie fest, wann es mit
+// dem naechsten Schritt weitergeht (Sleep, WaitUntil, Yield) bzw. mit
+// welchem Schritt (Goto, Repeat), oder ob die Koroutine beendet ist (Exit).
+// Der Dispatcher wird dabei nie blockiert. Bspw. die Schleife in
+// DAB.TuneService:
+//
+//	func (d *DAB) tuneStep(co *tinylib.Coroutine) {
+//	    switch co.Step() {
+//	    case 0:
+//	        d.si468x_start_digital_service(d.serviceId, d.compId)
+//	        co.WaitUntil(d.isClearToSend, 4*time.Millisecond, 4*time.Second)
+//	    case 1:
+//	        if co.TimedOut() || d.CmdError == 0 {
+//	            co.Exit()
+//	            return
+//	        }
+//	        co.Goto(0)
+//	        co.Sleep(4 * time.Millisecond)
+//	    }
+//	}
+//
+//	tinylib.Disp.AddTask(tinylib.NewCoroutine(d.tuneStep,
+//	    tinylib.TaskConfig{Name: "tune"}).Task())
+//
+// Ruft ein Schritt keine dieser Methoden auf, so wird der naechste Schritt
+// beim naechsten Tick ausgefuehrt (wie bei Yield).
+type Coroutine struct {
+	fnc       CoroutineFunc
+	task      *Task
+	step      int
+	next      int
+	wait      time.Duration
+	cond      func() bool
+	poll      time.Duration
+	deadline  time.Time
+	isTimeout bool
+	isDone    bool
+}
+
+// Funktionstyp der Schrittfunktion einer Koroutine.
+type CoroutineFunc func(co *Coroutine)
+
+const (
+	// Mit dieser Verzoegerung wird eine Koroutine nach Yield fortgesetzt.
+	coYieldDelay = time.Millisecond
+)
+
+// Erzeugt eine neue Koroutine mit der Schrittfunktion fnc. Die Koroutine
+// beginnt mit Schritt 0, sobald ihr Task (siehe Task) erstmals ausgefuehrt
+// wird. Das Intervall in cfg bestimmt den Zeitpunkt der ersten Ausfuehrung.
+func NewCoroutine(fnc CoroutineFunc, cfg TaskConfig) *Coroutine {
+	co := &Coroutine{fnc: fnc}
+	co.task = NewAdaptiveTask(co.run, cfg)
+	return co
+}
+
+// Liefert den Task, mit welchem die Koroutine beim Dispatcher eingeplant
+// wird.
+func (co *Coroutine) Task() *Task {
+	return co.task
+}
+
+// Liefert die Nummer des aktuellen Schrittes.
+func (co *Coroutine) Step() int {
+	return co.step
+}
+
+// Setzt die Koroutine nach Ablauf von d mit dem naechsten Schritt fort.
+func (co *Coroutine) Sleep(d time.Duration) {
+	co.wait = d
+	co.cond = nil
+}
+
+// Setzt die Koroutine mit dem naechsten Schritt fort, sobald cond true
+// liefert. Die Bedingung wird sofort und danach im Abstand von poll (jedoch
+// hoechstens einmal pro Millisekunde) geprueft. Ist timeout groesser 0 und
+// ist die Bedingung nach Ablauf von timeout noch immer nicht erfuellt, so
+// wird trotzdem fortgesetzt und TimedOut liefert im naechsten Schritt true.
+func (co *Coroutine) WaitUntil(cond func() bool, poll, timeout time.Duration) {
+	co.wait = 0
+	co.cond = cond
+	co.poll = max(poll, coYieldDelay)
+	co.deadline = time.Time{}
+	if timeout > 0 {
+		co.deadline = co.task.dispatcher().Now().Add(timeout)
+	}
+}
+
+// Gibt den Dispatcher frei; der naechste Schritt wird beim naechsten Tick
+// ausgefuehrt.
+func (co *Coroutine) Yield() {
+	co.wait = 0
+	co.cond = nil
+}
+
+// Legt fest, dass als naechstes der Schritt step ausgefuehrt wird. Wann
+// dies geschieht, bestimmen Sleep, WaitUntil oder Yield.
+func (co *Coroutine) Goto(step int) {
+	co.next = step
+}
+
+// Fuehrt den aktuellen Schritt nochmals aus (entspricht Goto(Step())).
+func (co *Coroutine) Repeat() {
+	co.next = co.step
+}
+
+// Beendet die Koroutine, ihr Task wird danach nicht mehr eingeplant.
+func (co *Coroutine) Exit() {
+	co.isDone = true
+}
+
+// Liefert true, falls das letzte WaitUntil durch das Timeout beendet wurde.
+func (co *Coroutine) TimedOut() bool {
+	return co.isTimeout
+}
+
+// Liefert true, falls die Koroutine mit Exit beendet wurde.
+func (co *Coroutine) Done() bool {
+	return co.isDone
+}
+
+// Setzt die Koroutine auf Schritt 0 zurueck. Eine beendete Koroutine kann
+// danach mit Task().Reschedule wieder gestartet werden.
+func (co *Coroutine) Reset() {
+	co.step = 0
+	co.wait = 0
+	co.cond = nil
+	co.isTimeout = false
+	co.isDone = false
+}
+
+// Dies ist die Funktion des adaptiven Tasks. Schritte, welche ohne Wartezeit
+// aufeinander folgen (bspw. WaitUntil mit bereits erfuellter Bedingung),
+// werden im selben Aufruf ausgefuehrt.
+func (co *Coroutine) run() time.Duration {
+	for {
+		if co.cond != nil {
+			if !co.cond() {
+				if co.deadline.IsZero() || co.task.dispatcher().Now().Before(co.deadline) {
+					return co.poll
+				}
+				co.isTimeout = true
+			}
+			co.cond = nil
+		}
+		co.next = co.step + 1
+		co.wait = 0
+		co.fnc(co)
+		co.isTimeout = false
+		if co.isDone {
+			return StopTask
+		}
+		co.step = co.next
+		if co.cond != nil {
+			continue
+		}
+		if co.wait > 0 {
+			return co.wait
+		}
+		return coYieldDelay
+	}
+}
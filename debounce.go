@@ -0,0 +1,132 @@
+package tinylib
+
+import (
+	"time"
+)
+
+// Verfahren zur Entprellung von digitalen Eingaengen.
+type DebounceMode uint8
+
+const (
+	// Keine Entprellung, der Eingang wird unveraendert uebernommen.
+	DebounceNone DebounceMode = iota
+	// Ein neuer Zustand wird erst uebernommen, wenn der Eingang waehrend
+	// DebounceConfig.Time unveraendert war.
+	DebounceStable
+	// Ein Zaehler wird bei jedem aktiven Sample erhoeht und bei jedem
+	// inaktiven verringert (begrenzt auf 0..DebounceConfig.Samples). Der
+	// Zustand wechselt erst, wenn der Zaehler eine der Grenzen erreicht.
+	DebounceIntegrator
+	// Ein neuer Zustand wird nach DebounceConfig.Samples aufeinander
+	// folgenden, gleichen Samples uebernommen.
+	DebounceCounter
+)
+
+const (
+	defDebounceTime    = 20 * time.Millisecond
+	defDebounceSamples = 4
+)
+
+func (m DebounceMode) String() string {
+	switch m {
+	case DebounceNone:
+		return "None"
+	case DebounceStable:
+		return "Stable"
+	case DebounceIntegrator:
+		return "Integrator"
+	case DebounceCounter:
+		return "Counter"
+	default:
+		return "(unspec. mode)"
+	}
+}
+
+type DebounceConfig struct {
+	Mode DebounceMode
+	// Geforderte Dauer ohne Aenderung bei DebounceStable (Default: 20 ms).
+	Time time.Duration
+	// Anzahl Samples bei DebounceIntegrator und DebounceCounter (Default:
+	// 4). Zusammen mit der Abfragerate ergibt sich daraus die Zeit, welche
+	// der Eingang zur Beruhigung hat.
+	Samples int
+}
+
+// Mit dem Debouncer wird ein periodisch abgefragter, digitaler Eingang
+// entprellt. Er wird von Button verwendet, kann aber fuer beliebige
+// Eingaenge (Schalter, Endanschlaege, etc.) eingesetzt werden.
+type Debouncer struct {
+	mode       DebounceMode
+	stableTime time.Duration
+	samples    int
+	state      bool
+	last       bool
+	lastChange time.Time
+	count      int
+}
+
+func (d *Debouncer) Configure(cfg DebounceConfig) {
+	if cfg.Time == 0 {
+		cfg.Time = defDebounceTime
+	}
+	if cfg.Samples == 0 {
+		cfg.Samples = defDebounceSamples
+	}
+	d.mode = cfg.Mode
+	d.stableTime = cfg.Time
+	d.samples = cfg.Samples
+	d.Reset(false)
+}
+
+// Setzt den entprellten Zustand auf state.
+func (d *Debouncer) Reset(state bool) {
+	d.state, d.last = state, state
+	d.lastChange = time.Time{}
+	d.count = 0
+	if d.mode == DebounceIntegrator && state {
+		d.count = d.samples
+	}
+}
+
+// Verarbeitet den zum Zeitpunkt now gelesenen Zustand raw des Eingangs und
+// liefert den entprellten Zustand.
+func (d *Debouncer) Update(raw bool, now time.Time) bool {
+	switch d.mode {
+	case DebounceStable:
+		if raw != d.last || d.lastChange.IsZero() {
+			d.last = raw
+			d.lastChange = now
+		}
+		if raw != d.state && now.Sub(d.lastChange) >= d.stableTime {
+			d.state = raw
+		}
+	case DebounceIntegrator:
+		if raw {
+			if d.count < d.samples {
+				d.count++
+			}
+		} else if d.count > 0 {
+			d.count--
+		}
+		if d.count == 0 {
+			d.state = false
+		} else if d.count == d.samples {
+			d.state = true
+		}
+	case DebounceCounter:
+		if raw == d.state {
+			d.count = 0
+		} else if d.count++; d.count >= d.samples {
+			d.state = raw
+			d.count = 0
+		}
+	default:
+		d.state = raw
+	}
+	return d.state
+}
+
+// Liefert den entprellten Zustand.
+func (d *Debouncer) State() bool {
+	return d.state
+}
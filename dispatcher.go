@@ -3,17 +3,21 @@
 package tinylib
 
 import (
+	"sync/atomic"
 	"time"
 )
 
 // Dieses File enthaelt alle Typen und Konstanten, um ein einfaches
-// Dispatching unter TinyGo auf einem Single-Core Microcontroller zu
-// realisieren. Im Wesentlichen gibt es zwei Typen:
+// Dispatching unter TinyGo auf einem Microcontroller zu realisieren (fuer
+// Microcontroller mit mehreren Kernen siehe auch Cores). Ohne das Build-Tag
+// 'inline' wird stattdessen der Dispatcher aus dispatcher_goroutine.go
+// verwendet, welcher dieselbe API anbietet. Im Wesentlichen gibt es zwei
+// Typen:
 //
 // Dispatcher: ist fuer die zeitlich korrekte Ausfuehrung der ihm
 //
-//	zugewiesenen Tasks verantwortlich. Es darf nur eine (1)
-//	Instanz dieses Typs geben!
+//	zugewiesenen Tasks verantwortlich. Pro Prozessorkern darf
+//	nur eine (1) Instanz dieses Typs Tasks ausfuehren!
 //
 // Task:       fuer jede periodisch ausfuehrbare Funktion oder Methode wird
 //
@@ -51,6 +55,7 @@ import (
 //	tinylib.TaskConfig{Interval: time.Second})
 //
 // tinylib.Disp.AddTask(ledTask)
+// tinylib.Disp.SetIdleHook(time.Sleep)
 //
 //	for {
 //	    tinylib.Disp.Tick()
@@ -64,145 +69,212 @@ var (
 )
 
 func init() {
-	Disp = NewDispatcher()
-}
-
-// Ist eine Alternative zu time.Now(), welche die aktuelle Zeit auf
-// Millisekunden genau liefert.
-func Now() time.Time {
-	return time.Now().Truncate(time.Millisecond)
-}
-
-func NowMS() int64 {
-	return Now().UnixMilli()
+	for i := range Cores {
+		Cores[i] = NewDispatcher()
+		Cores[i].BindCore(i)
+	}
+	Disp = Cores[0]
 }
 
 //----------------------------------------------------------------------------
 
-// Jede Funktion/Methode dieses Typs kann in einem Task hinterlegt und
-// periodisch durch den Dispatcher aufgerufen werden.
-type TaskFunc func()
+const (
+	// Fuer so viele Tasks wird im Dispatcher von Beginn weg Platz
+	// reserviert. Erst wenn mehr Tasks eingeplant werden, wird die
+	// Warteschlange vergroessert.
+	defTaskCapacity = 64
+)
 
-type TaskConfig struct {
-	ExecTime time.Time
-	Interval time.Duration
+type Dispatcher struct {
+	core       int
+	clock      Clock
+	idleHook   IdleFunc
+	readyQueue []*Task
+	seq        uint32
+	tasks      []*Task
+	current    *Task
+	tracer     *Tracer
+	load       loadMeter
+	posts      postQueue
+	isStopped  bool
+	// Wird von Run gesetzt und von jedem Kern gelesen (siehe AddTask).
+	isRunning atomic.Bool
 }
 
-type Task struct {
-	Func                  TaskFunc
-	execTime              time.Time
-	interval              time.Duration
-	next                  *Task
-	isHalting             bool
-	lastTerm, term, delay time.Duration
-	numCalls              uint32
+func NewDispatcher() *Dispatcher {
+	d := &Dispatcher{core: -1, clock: SystemClock{}}
+	d.readyQueue = make([]*Task, 0, defTaskCapacity)
+	d.posts.init()
+	return d
 }
 
-func NewTask(fnc TaskFunc, cfg TaskConfig) *Task {
-	t := &Task{}
-	t.Func = fnc
-	t.execTime = cfg.ExecTime
-	t.interval = cfg.Interval
-	return t
+// Fuegt den Task t dem Dispatcher hinzu. Ein angehaltener oder entfernter
+// Task wird damit wieder eingeplant, bei einem bereits eingeplanten Task
+// hat der Aufruf keine Wirkung. Wird die Methode waehrend der Ausfuehrung
+// von t aufgerufen (bspw. nach t.Halt()), so wird t nach dem Ende der
+// Ausfuehrung wie ueblich neu eingeplant.
+func (d *Dispatcher) AddTask(t *Task) {
+	d.add(t, false)
 }
 
-func (t *Task) Configure(cfg TaskConfig) {
-	t.execTime = cfg.ExecTime
-	t.interval = cfg.Interval
-}
+// Fuegt t dem Dispatcher hinzu. Mit paused wird t nur zugeordnet und im
+// Zustand TaskPaused belassen, d.h. erst mit Resume eingeplant (siehe
+// TaskGroup.AddTask).
+func (d *Dispatcher) add(t *Task, paused bool) {
+	currentTime := d.Now()
 
-func (t *Task) Start(now time.Time) {
-	if t.isHalting {
+	if t.state == TaskScheduled {
+		if paused {
+			d.remove(t)
+			t.state = TaskPaused
+		}
 		return
 	}
-	t.numCalls += 1
-	t.delay += now.Sub(t.execTime)
-	t0 := time.Now()
-	t.Run()
-	t.lastTerm = time.Since(t0)
-	t.term += t.lastTerm
-	t.execTime = now.Add(t.interval)
-}
-
-func (t *Task) Run() {
-	t.Func()
-}
-
-func (t *Task) Halt() {
-	t.isHalting = true
-}
-
-func (t *Task) Interval() time.Duration {
-	return t.interval
+	if t == d.current {
+		t.state = TaskRunning
+		if paused {
+			t.state = TaskPaused
+		}
+		return
+	}
+	if t.disp != nil && t.disp != d {
+		t.disp.unregister(t)
+	}
+	t.disp = d
+	t.planStart(currentTime)
+	if paused {
+		t.state = TaskPaused
+		d.register(t)
+		return
+	}
+	d.insert(t)
 }
 
-func (t *Task) SetInterval(i time.Duration) {
-	t.interval = i
+// Entfernt den Task t aus dem Dispatcher. Wird die Methode waehrend der
+// Ausfuehrung von t aufgerufen, so wird t danach nicht mehr eingeplant.
+// Gehoert t zu einem anderen Dispatcher, so wird der Aufruf an diesen
+// weitergeleitet (gilt auch fuer Pause und Resume).
+func (d *Dispatcher) RemoveTask(t *Task) {
+	if t.disp != nil && t.disp != d {
+		t.disp.RemoveTask(t)
+		return
+	}
+	if t.state == TaskScheduled {
+		d.remove(t)
+	}
+	t.state = TaskRemoved
+	d.unregister(t)
 }
 
-func (t *Task) NumCalls() uint32 {
-	return t.numCalls
+// Haelt den Task t an. Er bleibt dem Dispatcher zugeordnet, wird aber erst
+// nach einem Aufruf von Resume wieder ausgefuehrt.
+func (d *Dispatcher) Pause(t *Task) {
+	if t.disp != nil && t.disp != d {
+		t.disp.Pause(t)
+		return
+	}
+	switch t.state {
+	case TaskScheduled:
+		d.remove(t)
+		t.state = TaskPaused
+	case TaskRunning:
+		t.state = TaskPaused
+	}
 }
 
-func (t *Task) Term() time.Duration {
-	return t.term
+// Setzt einen mit Pause angehaltenen Task fort. Perioden, welche waehrend
+// der Pause verstrichen sind, werden uebersprungen; ein einmaliger Task,
+// dessen Zeitpunkt verstrichen ist, wird beim naechsten Tick ausgefuehrt.
+// Wird t waehrend seiner eigenen Ausfuehrung angehalten und fortgesetzt, so
+// wird er nach deren Ende wie ueblich neu eingeplant.
+func (d *Dispatcher) Resume(t *Task) {
+	if t.disp != nil && t.disp != d {
+		t.disp.Resume(t)
+		return
+	}
+	if t.state != TaskPaused {
+		return
+	}
+	if t == d.current {
+		t.state = TaskRunning
+		return
+	}
+	t.skipElapsed(d.Now())
+	d.insert(t)
 }
 
-func (t *Task) AvgTerm() time.Duration {
-	return t.term / time.Duration(t.numCalls)
+// Uebergibt fn an den Dispatcher, welcher die Funktion zu Beginn des
+// naechsten Ticks im Task-Kontext ausfuehrt. Diese Methode darf aus einer
+// Interrupt-Routine aufgerufen werden, fn sollte dann jedoch nicht dort
+// erzeugt werden (Closures benoetigen Speicher vom Heap), sondern bspw. als
+// Methodenwert bereits bei der Konfiguration:
+//
+//	func (e *Encoder) Configure(conf EncoderConfig) {
+//	    ...
+//	    e.updateFunc = e.update
+//	}
+//
+//	func (e *Encoder) isr(pin machine.Pin) {
+//	    tinylib.Disp.Post(e.updateFunc)
+//	}
+//
+// Ist die Queue voll, so wird der Aufruf verworfen, gezaehlt (siehe
+// PostOverflows) und false retourniert.
+func (d *Dispatcher) Post(fn func()) bool {
+	if d.tracer != nil {
+		d.tracer.post(0)
+	}
+	return d.posts.put(fn, nil, 0)
 }
 
-func (t *Task) Delay() time.Duration {
-	return t.delay
+// Wie Post, jedoch wird fn beim Aufruf das Argument arg uebergeben.
+func (d *Dispatcher) PostEvent(fn EventFunc, arg uint32) bool {
+	if d.tracer != nil {
+		d.tracer.post(arg)
+	}
+	return d.posts.put(nil, fn, arg)
 }
 
-func (t *Task) AvgDelay() time.Duration {
-	return t.delay / time.Duration(t.numCalls)
+// Liefert die Anzahl der verworfenen Aufrufe von Post und PostEvent.
+func (d *Dispatcher) PostOverflows() uint32 {
+	return d.posts.overflows.Load()
 }
 
-//----------------------------------------------------------------------------
-
-const (
-	loadMeasureLengthMS = 5000
-	loadSlotLengthMS    = 200
-	loadNumSlots        = loadMeasureLengthMS / loadSlotLengthMS
-)
-
-type Dispatcher struct {
-	readyList          *Task
-	termList           [loadNumSlots]time.Duration
-	currSlot, lastSlot uint8
+// Liefert eine Momentaufnahme der Statistik des Dispatchers und aller ihm
+// zugeordneten Tasks (inkl. der angehaltenen).
+func (d *Dispatcher) Stats() DispatcherStats {
+	s := DispatcherStats{
+		Time:          d.Now(),
+		Window:        loadMeasureLengthMS * time.Millisecond,
+		Load:          d.Load(),
+		NumTasks:      d.NumTasks(),
+		PostOverflows: d.PostOverflows(),
+		Tasks:         make([]TaskStats, len(d.tasks)),
+	}
+	for i, t := range d.tasks {
+		s.Tasks[i] = t.stats(d.windowIdx())
+	}
+	return s
 }
 
-func NewDispatcher() *Dispatcher {
-	return &Dispatcher{}
+// Plant den Task t neu (siehe Task.Reschedule).
+func (d *Dispatcher) reschedule(t *Task, delay time.Duration) {
+	if t.state == TaskScheduled {
+		d.remove(t)
+	}
+	t.disp = d
+	t.execTime = d.Now().Add(delay)
+	d.insert(t)
 }
 
-func (d *Dispatcher) AddTask(t *Task) {
-	currentTime := Now()
-
-	if t.execTime.Before(currentTime) {
-		t.execTime = currentTime.Add(t.interval)
-	}
-	if t.isHalting {
-		t.isHalting = false
-	} else {
-		d.insert(t)
-	}
+// Liefert den Zustand des Tasks t (siehe Task.State).
+func (d *Dispatcher) taskState(t *Task) TaskState {
+	return t.state
 }
 
-func (d *Dispatcher) Print() {
-	ptr := d.readyList
-	for i := 0; ptr != nil; i++ {
-		println("[", i, "]")
-		println("  numCalls  :", ptr.numCalls)
-		println("  execTime  :", ptr.execTime.String())
-		println("  interval  :", ptr.interval.String())
-		println("  isHalting :", ptr.isHalting)
-		println("  term      :", ptr.AvgTerm().String())
-		println("  delay     :", ptr.AvgDelay().String())
-		ptr = ptr.next
-	}
+// Liefert die Statistik des Tasks t (siehe Task.Stats).
+func (d *Dispatcher) taskStats(t *Task) TaskStats {
+	return t.stats(d.windowIdx())
 }
 
 // Ueber diese Methode wird das gesamte Dispatching gesteuert. Sie sollte
@@ -214,95 +286,195 @@ func (d *Dispatcher) Print() {
 //	for {
 //	    tinylib.Disp.Tick()
 //	}
-func (d *Dispatcher) Tick() {
-	currentTime := Now()
+//
+// Zu Beginn werden alle mit Post oder PostEvent uebergebenen Funktionen
+// ausgefuehrt. Ist der Dispatcher an einen Kern gebunden (siehe BindCore)
+// und wird Tick auf einem anderen Kern aufgerufen, so kehrt die Methode
+// sofort zurueck.
+//
+// Retourniert wird die Zeitspanne bis zur Ausfuehrung des naechsten Tasks
+// (bzw. defMaxIdleTime, falls kein Task eingeplant ist). Ist ein Idle-Hook
+// gesetzt, so wird dieser vor dem Verlassen der Methode mit genau dieser
+// Zeitspanne aufgerufen.
+func (d *Dispatcher) Tick() time.Duration {
+	if !d.onCore() {
+		return 0
+	}
+	for d.posts.runNext() {
+	}
+
+	currentTime := d.Now()
 
 	for {
 		task := d.pop(currentTime)
 		if task == nil {
-			return
+			break
 		}
-		if task.isHalting {
-			task.isHalting = false
-			continue
+		task.state = TaskRunning
+		d.current = task
+		if d.tracer != nil {
+			d.tracer.taskStart(task)
 		}
 		task.Start(currentTime)
-		d.currSlot = uint8((NowMS() % loadMeasureLengthMS) / loadSlotLengthMS)
-		if d.currSlot != d.lastSlot {
-			d.lastSlot = (d.lastSlot + 1) % loadNumSlots
-			for d.lastSlot != d.currSlot {
-				d.termList[d.lastSlot] = time.Duration(0)
-				d.lastSlot = (d.lastSlot + 1) % loadNumSlots
-			}
-			d.termList[d.currSlot] = task.lastTerm
-		} else {
-			d.termList[d.currSlot] += task.lastTerm
+		if d.tracer != nil {
+			d.tracer.taskStop(task)
 		}
-		if task.interval > 0 {
+		d.current = nil
+		d.addLoad(task.lastTerm)
+		task.account(d.windowIdx())
+		if task.state != TaskRunning {
+			continue
+		}
+		if task.interval > 0 && !task.isStopping {
 			d.insert(task)
+		} else {
+			task.state = TaskIdle
+			d.unregister(task)
 		}
 	}
+
+	idle := d.idleTime()
+	if idle > 0 && d.idleHook != nil {
+		d.idleHook(idle)
+	}
+	return idle
 }
 
-// Liefert die Anzahl der im Dispatcher registrierten Tasks. Da diese Methode
-// nicht synchronisiert ist, kann es zu geringfuegigen Abweichungen kommen.
+// Berechnet die Zeitspanne bis zur Ausfuehrung des naechsten Tasks.
+func (d *Dispatcher) idleTime() time.Duration {
+	if !d.posts.empty() {
+		return 0
+	}
+	next, ok := d.NextExecTime()
+	if !ok {
+		return defMaxIdleTime
+	}
+	idle := next.Sub(d.Now())
+	if idle < 0 {
+		idle = 0
+	}
+	return idle
+}
+
+// Liefert den Task, welcher gerade ausgefuehrt wird oder nil. Ist fuer die
+// Diagnose von einem anderen Kern aus gedacht (siehe Supervisor).
+func (d *Dispatcher) Running() *Task {
+	return d.current
+}
+
+// Liefert die Anzahl der im Dispatcher eingeplanten Tasks.
 func (d *Dispatcher) NumTasks() int {
-	n := 0
-	ptr := d.readyList
-	for ptr != nil {
-		n++
-		ptr = ptr.next
+	return len(d.readyQueue)
+}
+
+// Liefert den Ausfuehrungszeitpunkt des naechsten Tasks. Ist kein Task
+// registriert, so ist der zweite Rueckgabewert false.
+func (d *Dispatcher) NextExecTime() (time.Time, bool) {
+	if len(d.readyQueue) == 0 {
+		return time.Time{}, false
 	}
-	return n
+	return d.readyQueue[0].execTime, true
 }
 
 // Liefert die Systemlast in Prozent. Fuer die Berechnung wird das Verhaeltnis
 // der Task-Laufzeiten zum definierten Zeitfenster berechnet.
 func (d *Dispatcher) Load() uint8 {
-	sumDur := time.Duration(0)
-	for _, dur := range d.termList {
-		sumDur += dur
-	}
-	return uint8(100.0 * float64(sumDur) / float64(loadMeasureLengthMS * time.Millisecond))
+	return d.load.load(d.Now().UnixMilli())
 }
 
+// Die eingeplanten Tasks werden in einem binaeren Min-Heap verwaltet,
+// geordnet nach dem Ausfuehrungszeitpunkt. Bei gleichem Zeitpunkt
+// entscheidet die Reihenfolge des Einplanens. Jeder Task kennt seine
+// Position im Heap (heapIdx), damit er in O(log n) entfernt werden kann.
+
 // Diese Methode dient dazu, den naechsten zur Ausfuehrung bereiten Task zu
 // ermitteln. Liefert nil, falls aktuell kein Task zur Ausfuehrung bereit
 // steht.
 func (d *Dispatcher) pop(t time.Time) *Task {
-	var ptr *Task
-
-	if d.readyList == nil {
+	if len(d.readyQueue) == 0 || d.readyQueue[0].execTime.After(t) {
 		return nil
 	}
-	ptr = d.readyList
-	if ptr.execTime.After(t) {
-		return nil
-	}
-	d.readyList = ptr.next
-	ptr.next = nil
-	return ptr
+	task := d.readyQueue[0]
+	d.removeAt(0)
+	return task
 }
 
-// Stellt den Task sortiert in die Taskliste. Das Feld execTime des Tasks
+// Stellt den Task sortiert in die Warteschlange. Das Feld execTime des Tasks
 // muss vorgaengig korrekt ausgefuellt worden sein, diese Methode greift
 // auf dieses Feld nur lesend zu.
 func (d *Dispatcher) insert(task *Task) {
-	ptr := d.readyList
-
-	if ptr == nil {
-		d.readyList = task
-	} else if task.execTime.Before(ptr.execTime) {
-		task.next = ptr
-		d.readyList = task
-	} else {
-		for ptr.next != nil {
-			if task.execTime.Before(ptr.next.execTime) {
-				break
-			}
-			ptr = ptr.next
+	task.state = TaskScheduled
+	d.register(task)
+	task.seq = d.seq
+	d.seq++
+	task.heapIdx = len(d.readyQueue)
+	d.readyQueue = append(d.readyQueue, task)
+	d.up(task.heapIdx)
+}
+
+// Entfernt den Task aus der Warteschlange.
+func (d *Dispatcher) remove(task *Task) {
+	d.removeAt(task.heapIdx)
+}
+
+func (d *Dispatcher) removeAt(i int) {
+	n := len(d.readyQueue) - 1
+	task := d.readyQueue[i]
+	if i != n {
+		d.swap(i, n)
+	}
+	d.readyQueue[n] = nil
+	d.readyQueue = d.readyQueue[:n]
+	if i != n && !d.down(i) {
+		d.up(i)
+	}
+	task.heapIdx = -1
+}
+
+func (d *Dispatcher) less(i, j int) bool {
+	a, b := d.readyQueue[i], d.readyQueue[j]
+	if a.execTime.Equal(b.execTime) {
+		return int32(a.seq-b.seq) < 0
+	}
+	return a.execTime.Before(b.execTime)
+}
+
+func (d *Dispatcher) swap(i, j int) {
+	q := d.readyQueue
+	q[i], q[j] = q[j], q[i]
+	q[i].heapIdx = i
+	q[j].heapIdx = j
+}
+
+func (d *Dispatcher) up(i int) {
+	for i > 0 {
+		p := (i - 1) / 2
+		if !d.less(i, p) {
+			break
+		}
+		d.swap(i, p)
+		i = p
+	}
+}
+
+// Liefert true, falls der Eintrag an Position i nach unten verschoben
+// wurde.
+func (d *Dispatcher) down(i int) bool {
+	i0, n := i, len(d.readyQueue)
+	for {
+		l := 2*i + 1
+		if l >= n {
+			break
+		}
+		c := l
+		if r := l + 1; r < n && d.less(r, l) {
+			c = r
+		}
+		if !d.less(c, i) {
+			break
 		}
-		task.next = ptr.next
-		ptr.next = task
+		d.swap(i, c)
+		i = c
 	}
+	return i > i0
 }
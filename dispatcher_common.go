@@ -0,0 +1,153 @@
+package tinylib
+
+import (
+	"os"
+	"time"
+)
+
+// Dieses File enthaelt alles, was der kooperative Dispatcher (dispatcher.go,
+// Build-Tag 'inline') und der Dispatcher mit Goroutinen
+// (dispatcher_goroutine.go) gemeinsam haben. Beide Varianten erwarten in
+// ihrem Typ Dispatcher die Felder clock, idleHook, tasks und load.
+
+const (
+	loadMeasureLengthMS = 5000
+	loadSlotLengthMS    = 200
+	loadNumSlots        = loadMeasureLengthMS / loadSlotLengthMS
+	// So lange wird maximal pausiert, wenn kein Task eingeplant ist.
+	defMaxIdleTime = 100 * time.Millisecond
+)
+
+// Funktionstyp des Idle-Hooks, welcher von Tick mit der Zeitspanne bis zur
+// Ausfuehrung des naechsten Tasks aufgerufen wird. Geeignet sind bspw.
+// time.Sleep, ein Wrapper um die WFI-Instruktion oder im Test die Methode
+// Advance einer VirtualClock.
+type IdleFunc func(d time.Duration)
+
+// Setzt die Zeitquelle des Dispatchers. Standardmaessig wird die Systemuhr
+// verwendet, fuer Tests bietet sich eine VirtualClock an.
+func (d *Dispatcher) SetClock(c Clock) {
+	d.clock = c
+}
+
+// Setzt den Idle-Hook des Dispatchers. Mit nil wird er wieder entfernt.
+func (d *Dispatcher) SetIdleHook(fnc IdleFunc) {
+	d.idleHook = fnc
+}
+
+// Liefert die aktuelle Zeitquelle des Dispatchers.
+func (d *Dispatcher) Clock() Clock {
+	return d.clock
+}
+
+// Liefert die aktuelle Zeit der Dispatcher-Uhr auf Millisekunden genau.
+func (d *Dispatcher) Now() time.Time {
+	return d.clock.Now().Truncate(time.Millisecond)
+}
+
+// Fuehrt fnc einmalig nach Ablauf von delay aus. Der retournierte Task
+// dient als Handle, mit welchem die Ausfuehrung abgebrochen (Cancel) oder
+// verschoben (Reschedule) werden kann.
+func (d *Dispatcher) After(delay time.Duration, fnc TaskFunc) *Task {
+	return d.At(d.Now().Add(delay), fnc)
+}
+
+// Fuehrt fnc einmalig zum Zeitpunkt t aus. Liegt t in der Vergangenheit,
+// so wird fnc beim naechsten Tick ausgefuehrt.
+func (d *Dispatcher) At(t time.Time, fnc TaskFunc) *Task {
+	task := NewTask(fnc, TaskConfig{ExecTime: t})
+	d.AddTask(task)
+	return task
+}
+
+// Fuehrt fnc periodisch im Abstand von interval aus, erstmals nach Ablauf
+// von interval.
+func (d *Dispatcher) Every(interval time.Duration, fnc TaskFunc) *Task {
+	task := NewTask(fnc, TaskConfig{Interval: interval})
+	d.AddTask(task)
+	return task
+}
+
+// Gibt die Statistik aller Tasks in Textform auf der Standardausgabe aus.
+func (d *Dispatcher) Print() {
+	stats := d.Stats()
+	stats.Write(os.Stdout, StatsText)
+}
+
+// Verbucht die Laufzeit term in der Lastmessung.
+func (d *Dispatcher) addLoad(term time.Duration) {
+	d.load.add(d.Now().UnixMilli(), term)
+}
+
+// Liefert die Nummer des aktuellen Messfensters fuer die Task-Statistiken.
+func (d *Dispatcher) windowIdx() int64 {
+	return d.Now().UnixMilli() / loadMeasureLengthMS
+}
+
+// Nimmt den Task in die Liste aller dem Dispatcher zugeordneten Tasks auf.
+func (d *Dispatcher) register(task *Task) {
+	if task.isRegistered {
+		return
+	}
+	task.isRegistered = true
+	d.tasks = append(d.tasks, task)
+	if d.tracer != nil {
+		d.tracer.addTask(task)
+	}
+}
+
+// Entfernt den Task aus der Liste aller dem Dispatcher zugeordneten Tasks.
+func (d *Dispatcher) unregister(task *Task) {
+	if !task.isRegistered {
+		return
+	}
+	task.isRegistered = false
+	for i, t := range d.tasks {
+		if t == task {
+			d.tasks = append(d.tasks[:i], d.tasks[i+1:]...)
+			break
+		}
+	}
+}
+
+//----------------------------------------------------------------------------
+
+// Die Systemlast wird ueber ein gleitendes Zeitfenster von
+// loadMeasureLengthMS gemessen, welches in Slots von loadSlotLengthMS
+// unterteilt ist. Pro Slot wird die Summe der Task-Laufzeiten gefuehrt.
+type loadMeter struct {
+	termList           [loadNumSlots]time.Duration
+	currSlot, lastSlot uint8
+	lastLoadMS         int64
+}
+
+// Verbucht die Laufzeit term im aktuellen Slot des Messfensters. Slots,
+// welche seit dem letzten Aufruf verstrichen sind, werden dabei geloescht.
+func (m *loadMeter) add(nowMS int64, term time.Duration) {
+	if nowMS-m.lastLoadMS >= loadMeasureLengthMS {
+		m.termList = [loadNumSlots]time.Duration{}
+	}
+	m.lastLoadMS = nowMS
+	m.currSlot = uint8((nowMS % loadMeasureLengthMS) / loadSlotLengthMS)
+	if m.currSlot != m.lastSlot {
+		m.lastSlot = (m.lastSlot + 1) % loadNumSlots
+		for m.lastSlot != m.currSlot {
+			m.termList[m.lastSlot] = time.Duration(0)
+			m.lastSlot = (m.lastSlot + 1) % loadNumSlots
+		}
+		m.termList[m.currSlot] = term
+	} else {
+		m.termList[m.currSlot] += term
+	}
+}
+
+// Liefert die Last in Prozent, d.h. das Verhaeltnis der Task-Laufzeiten
+// zum Zeitfenster.
+func (m *loadMeter) load(nowMS int64) uint8 {
+	m.add(nowMS, 0)
+	sumDur := time.Duration(0)
+	for _, dur := range m.termList {
+		sumDur += dur
+	}
+	return uint8(100.0 * float64(sumDur) / float64(loadMeasureLengthMS*time.Millisecond))
+}
@@ -0,0 +1,533 @@
+//go:build !inline
+
+package tinylib
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Dieses File enthaelt eine alternative Implementation des Dispatchers,
+// welche verwendet wird, wenn das Build-Tag 'inline' nicht gesetzt ist. Sie
+// bietet dieselbe API wie der kooperative Dispatcher (Task, TaskConfig,
+// TaskGroup, Post, Stats, etc.), fuehrt jedoch jeden eingeplanten Task in
+// einer eigenen Goroutine aus, welche mit einem Timer auf den naechsten
+// Ausfuehrungszeitpunkt wartet (analog time.Ticker). Damit laeuft derselbe
+// Applikationscode auch auf einem Linux-Host, in Tests oder unter einem
+// TinyGo-Scheduler mit Goroutinen.
+//
+// Die Ausfuehrung der Tasks (und der mit Post uebergebenen Funktionen) ist
+// serialisiert, d.h. es ist nie mehr als ein Task gleichzeitig aktiv. Die
+// Tasks muessen daher untereinander nicht synchronisiert werden - genau wie
+// beim kooperativen Dispatcher. Die Methoden des Dispatchers und der Tasks
+// (AddTask, Pause, Reschedule, Stats, ...) duerfen aus beliebigen Goroutinen
+// und auch innerhalb von Tasks aufgerufen werden. Die einzelnen Statistik-
+// Methoden von Task (NumCalls, MaxTerm, ...) sind nicht synchronisiert,
+// eine konsistente Momentaufnahme liefert Task.Stats.
+//
+// Gemessen wird mit der Uhr des Dispatchers, gewartet wird jedoch immer in
+// Echtzeit. Eine VirtualClock ist daher nur mit dem kooperativen Dispatcher
+// sinnvoll.
+//
+//	tinylib.Disp.Every(time.Second, led.Toggle)
+//	go tinylib.Disp.Run()
+//	...
+//	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+//	defer cancel()
+//	if err := tinylib.Disp.Stop(ctx); err != nil {
+//	    log.Printf("tasks still running: %v", err)
+//	}
+var (
+	// Dies ist der Default-Dispatcher, welcher in diesem Package erzeugt wird.
+	Disp *Dispatcher
+)
+
+func init() {
+	Disp = NewDispatcher()
+}
+
+type Dispatcher struct {
+	// Schuetzt den Zustand, den Ausfuehrungszeitpunkt und die Statistik
+	// aller Tasks sowie die Felder des Dispatchers.
+	mu sync.Mutex
+	// Wird waehrend der Ausfuehrung eines Tasks gehalten und serialisiert
+	// damit die Tasks.
+	exec     sync.Mutex
+	clock    Clock
+	idleHook IdleFunc
+	tasks    []*Task
+	current  *Task
+	tracer   *Tracer
+	// Pro eingeplantem Task der Kanal, mit welchem seine Goroutine beendet
+	// wird.
+	runners   map[*Task]chan struct{}
+	load      loadMeter
+	posts     postQueue
+	postSig   chan struct{}
+	done      chan struct{}
+	isStopped bool
+	wg        sync.WaitGroup
+}
+
+func NewDispatcher() *Dispatcher {
+	d := &Dispatcher{clock: SystemClock{}}
+	d.runners = make(map[*Task]chan struct{})
+	d.postSig = make(chan struct{}, 1)
+	d.done = make(chan struct{})
+	d.posts.init()
+	return d
+}
+
+// Fuegt den Task t dem Dispatcher hinzu. Ein angehaltener oder entfernter
+// Task wird damit wieder eingeplant, bei einem bereits eingeplanten Task
+// hat der Aufruf keine Wirkung. Wird die Methode waehrend der Ausfuehrung
+// von t aufgerufen (bspw. nach t.Halt()), so wird t nach dem Ende der
+// Ausfuehrung wie ueblich neu eingeplant.
+func (d *Dispatcher) AddTask(t *Task) {
+	d.add(t, false)
+}
+
+// Fuegt t dem Dispatcher hinzu. Mit paused wird t nur zugeordnet und im
+// Zustand TaskPaused belassen, d.h. erst mit Resume eingeplant (siehe
+// TaskGroup.AddTask).
+func (d *Dispatcher) add(t *Task, paused bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t.state == TaskScheduled {
+		if paused {
+			d.remove(t)
+			t.state = TaskPaused
+		}
+		return
+	}
+	if t == d.current {
+		t.state = TaskRunning
+		if paused {
+			t.state = TaskPaused
+		}
+		return
+	}
+	if old := t.disp; old != nil && old != d {
+		old.mu.Lock()
+		old.unregister(t)
+		old.mu.Unlock()
+	}
+	t.disp = d
+	t.planStart(d.Now())
+	if paused {
+		t.state = TaskPaused
+		d.register(t)
+		return
+	}
+	d.insert(t)
+}
+
+// Entfernt den Task t aus dem Dispatcher. Wird die Methode waehrend der
+// Ausfuehrung von t aufgerufen, so wird t danach nicht mehr eingeplant.
+// Gehoert t zu einem anderen Dispatcher, so wird der Aufruf an diesen
+// weitergeleitet (gilt auch fuer Pause und Resume).
+func (d *Dispatcher) RemoveTask(t *Task) {
+	if other := d.lockOwner(t); other != nil {
+		other.RemoveTask(t)
+		return
+	}
+	defer d.mu.Unlock()
+	if t.state == TaskScheduled {
+		d.remove(t)
+	}
+	t.state = TaskRemoved
+	d.unregister(t)
+}
+
+// Haelt den Task t an. Er bleibt dem Dispatcher zugeordnet, wird aber erst
+// nach einem Aufruf von Resume wieder ausgefuehrt.
+func (d *Dispatcher) Pause(t *Task) {
+	if other := d.lockOwner(t); other != nil {
+		other.Pause(t)
+		return
+	}
+	defer d.mu.Unlock()
+	switch t.state {
+	case TaskScheduled:
+		d.remove(t)
+		t.state = TaskPaused
+	case TaskRunning:
+		t.state = TaskPaused
+	}
+}
+
+// Setzt einen mit Pause angehaltenen Task fort. Perioden, welche waehrend
+// der Pause verstrichen sind, werden uebersprungen; ein einmaliger Task,
+// dessen Zeitpunkt verstrichen ist, wird sofort ausgefuehrt. Wird
+// t waehrend seiner eigenen Ausfuehrung angehalten und fortgesetzt, so wird
+// er nach deren Ende wie ueblich neu eingeplant.
+func (d *Dispatcher) Resume(t *Task) {
+	if other := d.lockOwner(t); other != nil {
+		other.Resume(t)
+		return
+	}
+	defer d.mu.Unlock()
+	if t.state != TaskPaused {
+		return
+	}
+	if t == d.current {
+		t.state = TaskRunning
+		return
+	}
+	t.skipElapsed(d.Now())
+	d.insert(t)
+}
+
+// Uebergibt fn an den Dispatcher, welcher die Funktion im naechsten Tick
+// ausfuehrt (siehe Run). Ist die Queue voll, so wird der Aufruf verworfen,
+// gezaehlt (siehe PostOverflows) und false retourniert.
+func (d *Dispatcher) Post(fn func()) bool {
+	if d.tracer != nil {
+		d.tracer.post(0)
+	}
+	return d.signal(d.posts.put(fn, nil, 0))
+}
+
+// Wie Post, jedoch wird fn beim Aufruf das Argument arg uebergeben.
+func (d *Dispatcher) PostEvent(fn EventFunc, arg uint32) bool {
+	if d.tracer != nil {
+		d.tracer.post(arg)
+	}
+	return d.signal(d.posts.put(nil, fn, arg))
+}
+
+// Liefert die Anzahl der verworfenen Aufrufe von Post und PostEvent.
+func (d *Dispatcher) PostOverflows() uint32 {
+	return d.posts.overflows.Load()
+}
+
+// Weckt einen in Tick wartenden Dispatcher auf, falls ok gesetzt ist.
+func (d *Dispatcher) signal(ok bool) bool {
+	if ok {
+		select {
+		case d.postSig <- struct{}{}:
+		default:
+		}
+	}
+	return ok
+}
+
+// Liefert eine Momentaufnahme der Statistik des Dispatchers und aller ihm
+// zugeordneten Tasks (inkl. der angehaltenen).
+func (d *Dispatcher) Stats() DispatcherStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.Now()
+	s := DispatcherStats{
+		Time:          now,
+		Window:        loadMeasureLengthMS * time.Millisecond,
+		Load:          d.load.load(now.UnixMilli()),
+		NumTasks:      len(d.runners),
+		PostOverflows: d.PostOverflows(),
+		Tasks:         make([]TaskStats, len(d.tasks)),
+	}
+	for i, t := range d.tasks {
+		s.Tasks[i] = t.stats(d.windowIdx())
+	}
+	return s
+}
+
+// Plant den Task t neu (siehe Task.Reschedule).
+func (d *Dispatcher) reschedule(t *Task, delay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t.state == TaskScheduled {
+		d.remove(t)
+	}
+	t.disp = d
+	t.execTime = d.Now().Add(delay)
+	d.insert(t)
+}
+
+// Liefert den Zustand des Tasks t (siehe Task.State).
+func (d *Dispatcher) taskState(t *Task) TaskState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return t.state
+}
+
+// Liefert die Statistik des Tasks t (siehe Task.Stats).
+func (d *Dispatcher) taskStats(t *Task) TaskStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return t.stats(d.windowIdx())
+}
+
+// Fuehrt alle mit Post oder PostEvent uebergebenen Funktionen aus. Da die
+// Tasks in eigenen Goroutinen laufen, ist dies die einzige Aufgabe von Tick.
+// Anschliessend wird gewartet - mit dem Idle-Hook, falls einer gesetzt ist,
+// sonst bis zum naechsten Post oder bis zur Ausfuehrung des naechsten
+// Tasks. Im Gegensatz zum kooperativen Dispatcher kehrt Tick also nicht
+// sofort zurueck, damit eine Schleife um Tick die Tasks nicht aushungert.
+//
+// Retourniert wird die Zeitspanne bis zur Ausfuehrung des naechsten Tasks
+// (bzw. defMaxIdleTime, falls kein Task eingeplant ist).
+func (d *Dispatcher) Tick() time.Duration {
+	d.exec.Lock()
+	for d.posts.runNext() {
+	}
+	d.exec.Unlock()
+
+	idle := d.idleTime()
+	switch {
+	case idle <= 0:
+		runtime.Gosched()
+	case d.idleHook != nil:
+		d.idleHook(idle)
+	default:
+		timer := time.NewTimer(idle)
+		select {
+		case <-timer.C:
+		case <-d.postSig:
+		case <-d.done:
+		}
+		timer.Stop()
+	}
+	return idle
+}
+
+// Berechnet die Zeitspanne bis zur Ausfuehrung des naechsten Tasks.
+func (d *Dispatcher) idleTime() time.Duration {
+	if !d.posts.empty() {
+		return 0
+	}
+	next, ok := d.NextExecTime()
+	if !ok {
+		return defMaxIdleTime
+	}
+	idle := next.Sub(d.Now())
+	if idle < 0 {
+		idle = 0
+	}
+	return idle
+}
+
+// Ruft Tick in einer Schleife auf, bis der Dispatcher mit Stop angehalten
+// wird.
+func (d *Dispatcher) Run() {
+	for {
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+		d.Tick()
+	}
+}
+
+// Haelt den Dispatcher an: es werden keine Tasks mehr gestartet, laufende
+// Tasks werden jedoch noch zu Ende ausgefuehrt. Stop wartet, bis alle
+// Goroutinen der Tasks beendet sind, oder bis ctx abgelaufen ist; in diesem
+// Fall wird der Fehler von ctx retourniert. Innerhalb eines Tasks darf
+// Stop daher nur mit einem bereits abgelaufenen ctx aufgerufen werden. Ein
+// angehaltener Dispatcher kann nicht wieder gestartet werden.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.isStopped {
+		d.isStopped = true
+		close(d.done)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Liefert den Task, welcher gerade ausgefuehrt wird oder nil.
+func (d *Dispatcher) Running() *Task {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.current
+}
+
+// Liefert die Anzahl der im Dispatcher eingeplanten Tasks.
+func (d *Dispatcher) NumTasks() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.runners)
+}
+
+// Liefert den Ausfuehrungszeitpunkt des naechsten Tasks. Ist kein Task
+// registriert, so ist der zweite Rueckgabewert false.
+func (d *Dispatcher) NextExecTime() (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var next time.Time
+	for t := range d.runners {
+		if next.IsZero() || t.execTime.Before(next) {
+			next = t.execTime
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Liefert die Systemlast in Prozent. Fuer die Berechnung wird das Verhaeltnis
+// der Task-Laufzeiten zum definierten Zeitfenster berechnet.
+func (d *Dispatcher) Load() uint8 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.load.load(d.Now().UnixMilli())
+}
+
+// Plant den Task ein und startet seine Goroutine. Wie beim kooperativen
+// Dispatcher muss execTime vorgaengig gesetzt worden sein. Aufruf nur mit
+// gehaltenem d.mu.
+func (d *Dispatcher) insert(task *Task) {
+	task.state = TaskScheduled
+	d.register(task)
+	if d.isStopped {
+		return
+	}
+	quit := make(chan struct{})
+	d.runners[task] = quit
+	d.wg.Add(1)
+	go d.runTask(task, quit)
+}
+
+// Sperrt d.mu und liefert nil, falls t diesem (oder keinem) Dispatcher
+// zugeordnet ist. Gehoert t zu einem anderen Dispatcher, so wird dieser
+// retourniert und d.mu nicht gesperrt.
+func (d *Dispatcher) lockOwner(t *Task) *Dispatcher {
+	d.mu.Lock()
+	if other := t.disp; other != nil && other != d {
+		d.mu.Unlock()
+		return other
+	}
+	return nil
+}
+
+// Beendet die Goroutine des Tasks. Aufruf nur mit gehaltenem d.mu.
+func (d *Dispatcher) remove(task *Task) {
+	if quit, ok := d.runners[task]; ok {
+		close(quit)
+		delete(d.runners, task)
+	}
+}
+
+// Dies ist die Goroutine eines eingeplanten Tasks. Sie wartet jeweils bis
+// zum Ausfuehrungszeitpunkt, fuehrt den Task aus und plant ihn bei Bedarf
+// wieder ein. Wird quit geschlossen (remove) oder der Dispatcher angehalten,
+// so endet sie.
+func (d *Dispatcher) runTask(t *Task, quit chan struct{}) {
+	defer d.wg.Done()
+	for {
+		d.mu.Lock()
+		wait := t.execTime.Sub(d.Now())
+		d.mu.Unlock()
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-quit:
+				timer.Stop()
+				return
+			case <-d.done:
+				timer.Stop()
+				return
+			}
+		}
+
+		d.exec.Lock()
+		d.mu.Lock()
+		select {
+		case <-quit:
+			d.mu.Unlock()
+			d.exec.Unlock()
+			return
+		default:
+		}
+		if d.isStopped {
+			d.mu.Unlock()
+			d.exec.Unlock()
+			return
+		}
+		now := d.Now()
+		if t.execTime.After(now) {
+			d.mu.Unlock()
+			d.exec.Unlock()
+			continue
+		}
+		delete(d.runners, t)
+		t.state = TaskRunning
+		d.current = t
+		delay := now.Sub(t.execTime)
+		d.mu.Unlock()
+
+		if d.tracer != nil {
+			d.tracer.taskStart(t)
+		}
+		t0 := d.clock.Now()
+		next := t.call()
+		t1 := d.clock.Now()
+		if d.tracer != nil {
+			d.tracer.taskStop(t)
+		}
+
+		d.mu.Lock()
+		d.current = nil
+		overrun := t.finish(now, t1, delay, t1.Sub(t0), next)
+		term := t.lastTerm
+		d.addLoad(term)
+		t.account(d.windowIdx())
+		again := false
+		if t.state == TaskRunning {
+			if t.interval > 0 && !t.isStopping {
+				t.state = TaskScheduled
+				if !d.isStopped {
+					d.runners[t] = quit
+					again = true
+				}
+			} else {
+				t.state = TaskIdle
+				d.unregister(t)
+			}
+		}
+		d.mu.Unlock()
+		if overrun && t.overrunCB != nil {
+			t.overrunCB(t, term)
+		}
+		d.exec.Unlock()
+		if !again {
+			return
+		}
+	}
+}
+
+//----------------------------------------------------------------------------
+
+// Fuegt den Task t dem Default-Dispatcher hinzu. Entspricht der gleich-
+// namigen Funktion des kooperativen Dispatchers, TaskConfig.Core wird
+// jedoch ignoriert und es wird immer true retourniert.
+func AddTask(t *Task) bool {
+	Disp.AddTask(t)
+	return true
+}
+
+// Entspricht der gleichnamigen Funktion des kooperativen Dispatchers. Da es
+// nur den Default-Dispatcher gibt, wird einfach Disp.Run aufgerufen.
+func RunCores() {
+	Disp.Run()
+}
+
+// Uebergibt fn dem Default-Dispatcher (siehe Dispatcher.Post). Entspricht
+// der gleichnamigen Funktion des kooperativen Dispatchers, core wird
+// jedoch ignoriert.
+func PostTo(core int, fn func()) bool {
+	return Disp.Post(fn)
+}
@@ -0,0 +1,178 @@
+//go:build !inline
+
+package tinylib
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Haelt d an und prueft, dass alle Goroutinen der Tasks beendet wurden.
+func stopDispatcher(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+}
+
+// Wartet hoechstens eine Sekunde, bis cond erfuellt ist.
+func waitFor(cond func() bool) bool {
+	for end := time.Now().Add(time.Second); time.Now().Before(end); {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return cond()
+}
+
+func TestGoroutinePausedGroup(t *testing.T) {
+	d := NewDispatcher()
+	g := d.NewTaskGroup("screen")
+	g.Pause()
+	// Pausiert die Gruppe aus einem Task heraus, waehrend ihr gleichzeitig
+	// Tasks hinzugefuegt werden.
+	d.Every(time.Millisecond, g.Pause)
+	var numCalls atomic.Int32
+	for range 50 {
+		g.AddTask(NewTask(func() { numCalls.Add(1) }, TaskConfig{
+			Interval: time.Millisecond,
+		}))
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := numCalls.Load(); n != 0 {
+		t.Fatalf("tasks of paused group ran %d times", n)
+	}
+	g.Resume()
+	if !waitFor(func() bool { return numCalls.Load() > 0 || g.IsPaused() }) {
+		t.Fatal("tasks not resumed")
+	}
+	stopDispatcher(t, d)
+}
+
+func TestGoroutineEveryStop(t *testing.T) {
+	d := NewDispatcher()
+	var numCalls atomic.Int32
+	d.Every(2*time.Millisecond, func() { numCalls.Add(1) })
+	if !waitFor(func() bool { return numCalls.Load() >= 3 }) {
+		t.Fatalf("only %d calls", numCalls.Load())
+	}
+	stopDispatcher(t, d)
+	n := numCalls.Load()
+	time.Sleep(10 * time.Millisecond)
+	if numCalls.Load() != n {
+		t.Fatal("task ran after Stop")
+	}
+}
+
+func TestGoroutineRescheduleInside(t *testing.T) {
+	d := NewDispatcher()
+	var numCalls atomic.Int32
+	var task *Task
+	task = NewTask(func() {
+		if numCalls.Add(1) < 3 {
+			task.Reschedule(time.Millisecond)
+		}
+	}, TaskConfig{})
+	d.AddTask(task)
+	if !waitFor(func() bool { return numCalls.Load() == 3 }) {
+		t.Fatalf("got %d calls, want 3", numCalls.Load())
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := numCalls.Load(); n != 3 {
+		t.Fatalf("got %d calls, want 3", n)
+	}
+	if s := task.State(); s != TaskIdle {
+		t.Fatalf("task state %v, want idle", s)
+	}
+	stopDispatcher(t, d)
+}
+
+func TestGoroutinePauseWhileRunning(t *testing.T) {
+	d := NewDispatcher()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var numCalls atomic.Int32
+	task := NewTask(func() {
+		if numCalls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+	}, TaskConfig{Interval: time.Millisecond})
+	d.AddTask(task)
+	<-started
+	d.Pause(task)
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	if n := numCalls.Load(); n != 1 {
+		t.Fatalf("paused task ran %d times", n)
+	}
+	if s := task.State(); s != TaskPaused {
+		t.Fatalf("task state %v, want paused", s)
+	}
+	d.Resume(task)
+	if !waitFor(func() bool { return numCalls.Load() > 3 }) {
+		t.Fatal("task not resumed")
+	}
+	stopDispatcher(t, d)
+}
+
+func TestGoroutinePostRun(t *testing.T) {
+	const numPosts = 10
+
+	d := NewDispatcher()
+	go d.Run()
+	var order []int
+	var numDone atomic.Int32
+	for i := range numPosts {
+		if !d.Post(func() {
+			order = append(order, i)
+			numDone.Add(1)
+		}) {
+			t.Fatalf("post %d rejected", i)
+		}
+	}
+	if !waitFor(func() bool { return numDone.Load() == numPosts }) {
+		t.Fatalf("only %d of %d posts run", numDone.Load(), numPosts)
+	}
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("post %d run at position %d", v, i)
+		}
+	}
+	stopDispatcher(t, d)
+}
+
+func TestGoroutineStats(t *testing.T) {
+	d := NewDispatcher()
+	fast := NewTask(func() {}, TaskConfig{Name: "fast", Interval: time.Millisecond})
+	slow := NewTask(func() {}, TaskConfig{Name: "slow", Interval: time.Hour})
+	d.AddTask(fast)
+	d.AddTask(slow)
+	if !waitFor(func() bool { return fast.Stats().NumCalls >= 5 }) {
+		t.Fatal("fast task not running")
+	}
+	s := d.Stats()
+	if s.NumTasks != 2 || len(s.Tasks) != 2 {
+		t.Fatalf("got %d/%d tasks, want 2", s.NumTasks, len(s.Tasks))
+	}
+	for _, ts := range s.Tasks {
+		switch ts.Name {
+		case "fast":
+			if ts.NumCalls < 5 || ts.State == TaskIdle {
+				t.Errorf("fast: %+v", ts)
+			}
+		case "slow":
+			if ts.NumCalls != 0 || ts.State != TaskScheduled {
+				t.Errorf("slow: %+v", ts)
+			}
+		default:
+			t.Errorf("unknown task %q", ts.Name)
+		}
+	}
+	stopDispatcher(t, d)
+}
@@ -0,0 +1,249 @@
+//go:build inline
+
+package tinylib
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestReAddAfterRemove(t *testing.T) {
+	d, clk := newTestDispatcher()
+	numCalls := 0
+	task := NewTask(func() { numCalls++ }, TaskConfig{
+		Interval: 10 * time.Millisecond,
+		Mode:     FixedRate,
+		CatchUp:  CatchUpBurst,
+	})
+	d.AddTask(task)
+	clk.RunUntil(clk.Now().Add(50*time.Millisecond), d)
+	if numCalls != 5 {
+		t.Fatalf("got %d calls, want 5", numCalls)
+	}
+	d.RemoveTask(task)
+	clk.Advance(10 * time.Second)
+	d.AddTask(task)
+	d.Tick()
+	if numCalls != 5 {
+		t.Fatalf("re-added task ran %d times at once", numCalls-5)
+	}
+	clk.RunUntil(clk.Now().Add(10*time.Millisecond), d)
+	if numCalls != 6 {
+		t.Fatalf("got %d calls, want 6", numCalls)
+	}
+}
+
+func TestExecTimeInPast(t *testing.T) {
+	d, clk := newTestDispatcher()
+	numCalls := 0
+	task := d.At(clk.Now().Add(-time.Second), func() { numCalls++ })
+	d.Tick()
+	if numCalls != 1 {
+		t.Fatalf("got %d calls, want 1", numCalls)
+	}
+	// Erneut hinzugefuegt, laeuft der Task nach Ablauf von Interval (0).
+	d.AddTask(task)
+	d.Tick()
+	if numCalls != 2 {
+		t.Fatalf("got %d calls, want 2", numCalls)
+	}
+}
+
+func TestHaltAndAddInsideTask(t *testing.T) {
+	d, clk := newTestDispatcher()
+	numCalls := 0
+	var task *Task
+	task = NewTask(func() {
+		numCalls++
+		task.Halt()
+		d.AddTask(task)
+	}, TaskConfig{Interval: 10 * time.Millisecond})
+	d.AddTask(task)
+	clk.Advance(10 * time.Millisecond)
+	d.Tick()
+	if numCalls != 1 || task.State() != TaskScheduled {
+		t.Fatalf("got %d calls, state %v", numCalls, task.State())
+	}
+	if next, _ := d.NextExecTime(); !next.Equal(clk.Now().Add(10 * time.Millisecond)) {
+		t.Fatalf("next run at %v, want %v", next, clk.Now().Add(10*time.Millisecond))
+	}
+}
+
+func TestPauseAndResumeInsideTask(t *testing.T) {
+	d, clk := newTestDispatcher()
+	numCalls := 0
+	var task *Task
+	task = NewTask(func() {
+		numCalls++
+		d.Pause(task)
+		d.Resume(task)
+	}, TaskConfig{Interval: 10 * time.Millisecond})
+	d.AddTask(task)
+	clk.RunUntil(clk.Now().Add(30*time.Millisecond), d)
+	if numCalls != 3 || task.State() != TaskScheduled {
+		t.Fatalf("got %d calls, state %v", numCalls, task.State())
+	}
+}
+
+func TestForeignTask(t *testing.T) {
+	d1, clk := newTestDispatcher()
+	d2 := NewDispatcher()
+	d2.SetClock(clk)
+	t1 := d1.Every(10*time.Millisecond, func() {})
+	t2 := d2.Every(10*time.Millisecond, func() {})
+	d2.Pause(t1)
+	if t1.State() != TaskPaused || t2.State() != TaskScheduled || d2.NumTasks() != 1 {
+		t.Fatalf("pause: t1 %v, t2 %v", t1.State(), t2.State())
+	}
+	d2.Resume(t1)
+	d2.RemoveTask(t1)
+	if t1.State() != TaskRemoved || d1.NumTasks() != 0 || d2.NumTasks() != 1 {
+		t.Fatalf("remove: t1 %v, d1 %d, d2 %d", t1.State(), d1.NumTasks(), d2.NumTasks())
+	}
+}
+
+// Erzeugt n Tasks mit zufaelligen Ausfuehrungszeitpunkten und stellt sie in
+// die Warteschlange von d.
+func fillQueue(d *Dispatcher, rnd *rand.Rand, n int) []*Task {
+	base := d.Now()
+	tasks := make([]*Task, n)
+	for i := range tasks {
+		tasks[i] = NewTask(func() {}, TaskConfig{})
+		tasks[i].execTime = base.Add(time.Duration(rnd.Intn(1000)) * time.Millisecond)
+		d.insert(tasks[i])
+	}
+	return tasks
+}
+
+// Prueft die Heap-Eigenschaft und die Positionen der Tasks.
+func checkHeap(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	for i, task := range d.readyQueue {
+		if task.heapIdx != i {
+			t.Fatalf("task at %d has heapIdx %d", i, task.heapIdx)
+		}
+		if i > 0 && d.less(i, (i-1)/2) {
+			t.Fatalf("heap order violated at %d", i)
+		}
+	}
+}
+
+func TestHeapFIFO(t *testing.T) {
+	d, clk := newTestDispatcher()
+	tasks := make([]*Task, 8)
+	for i := range tasks {
+		tasks[i] = NewTask(func() {}, TaskConfig{ExecTime: clk.Now()})
+		d.AddTask(tasks[i])
+	}
+	for i, want := range tasks {
+		if got := d.pop(clk.Now()); got != want {
+			t.Fatalf("pop %d: got task with seq %d, want %d", i, got.seq, want.seq)
+		}
+	}
+}
+
+func TestHeapRemove(t *testing.T) {
+	d, _ := newTestDispatcher()
+	rnd := rand.New(rand.NewSource(1))
+	tasks := fillQueue(d, rnd, 100)
+	for _, i := range rnd.Perm(len(tasks))[:40] {
+		d.remove(tasks[i])
+		if tasks[i].heapIdx != -1 {
+			t.Fatalf("removed task still has heapIdx %d", tasks[i].heapIdx)
+		}
+		checkHeap(t, d)
+	}
+	if len(d.readyQueue) != 60 {
+		t.Fatalf("queue has %d tasks, want 60", len(d.readyQueue))
+	}
+	var last time.Time
+	for task := d.pop(d.Now().Add(time.Hour)); task != nil; task = d.pop(d.Now().Add(time.Hour)) {
+		if task.execTime.Before(last) {
+			t.Fatal("tasks popped out of order")
+		}
+		last = task.execTime
+		checkHeap(t, d)
+	}
+}
+
+var benchSizes = []int{10, 100, 1000}
+
+func BenchmarkInsert(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			d, _ := newTestDispatcher()
+			rnd := rand.New(rand.NewSource(1))
+			fillQueue(d, rnd, n)
+			task := NewTask(func() {}, TaskConfig{})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				task.execTime = d.Now().Add(time.Duration(rnd.Intn(1000)) * time.Millisecond)
+				d.insert(task)
+				d.remove(task)
+			}
+		})
+	}
+}
+
+func BenchmarkPop(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			d, _ := newTestDispatcher()
+			rnd := rand.New(rand.NewSource(1))
+			fillQueue(d, rnd, n)
+			end := d.Now().AddDate(1000, 0, 0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				task := d.pop(end)
+				task.execTime = task.execTime.Add(time.Duration(rnd.Intn(1000)) * time.Millisecond)
+				d.insert(task)
+			}
+		})
+	}
+}
+
+func TestResumeSkipsPausedPeriods(t *testing.T) {
+	d, clk := newTestDispatcher()
+	g := d.NewTaskGroup("screen")
+	numCalls := 0
+	g.AddTask(NewTask(func() { numCalls++ }, TaskConfig{
+		Interval: 10 * time.Millisecond,
+		Mode:     FixedRate,
+		CatchUp:  CatchUpBurst,
+	}))
+	clk.RunUntil(clk.Now().Add(25*time.Millisecond), d)
+	g.Pause()
+	clk.Advance(time.Minute)
+	g.Resume()
+	d.Tick()
+	if numCalls > 3 {
+		t.Fatalf("resumed task ran %d times at once", numCalls-2)
+	}
+	clk.RunUntil(clk.Now().Add(100*time.Millisecond), d)
+	if numCalls != 12 {
+		t.Fatalf("got %d calls, want 12", numCalls)
+	}
+}
+
+func TestAddToPausedGroup(t *testing.T) {
+	d, clk := newTestDispatcher()
+	g := d.NewTaskGroup("screen")
+	g.Pause()
+	numCalls := 0
+	task := NewTask(func() { numCalls++ }, TaskConfig{Interval: 10 * time.Millisecond})
+	g.AddTask(task)
+	if task.State() != TaskPaused {
+		t.Fatalf("task state %v, want paused", task.State())
+	}
+	clk.RunUntil(clk.Now().Add(100*time.Millisecond), d)
+	if numCalls != 0 {
+		t.Fatalf("paused task ran %d times", numCalls)
+	}
+	g.Resume()
+	clk.RunUntil(clk.Now().Add(100*time.Millisecond), d)
+	if numCalls != 11 {
+		t.Fatalf("got %d calls, want 11", numCalls)
+	}
+}
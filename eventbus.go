@@ -0,0 +1,160 @@
+package tinylib
+
+import (
+	"sync"
+)
+
+// Ein Topic verteilt Ereignisse vom Typ T an beliebig viele Abonnenten.
+// Die Zustellung erfolgt nicht beim Aufruf von Publish, sondern ueber
+// Dispatcher.Post im Kontext des Dispatchers, d.h. die Abonnenten werden
+// nacheinander und nie parallel zu den Tasks dieses Dispatchers
+// aufgerufen. Damit koennen bspw. Widgets, Logging und Persistenz auf
+// dasselbe Ereignis reagieren, ohne dass Callbacks verkettet werden
+// muessen.
+//
+//	volume := tinylib.NewTopic[int]("volume", nil)
+//	enc.SetOnRotation(func(dir tinylib.Direction, steps int) {
+//	    if dir == tinylib.CW {
+//	        vol += steps
+//	    } else {
+//	        vol -= steps
+//	    }
+//	    volume.Publish(vol)
+//	})
+//	bar := volume.Subscribe(func(v int) { volBar.SetValue(v) })
+//	volume.Subscribe(func(v int) { conf.Volume = v })
+//	...
+//	bar.Cancel()
+//
+// Publish erzeugt fuer jedes Ereignis eine Closure und sollte daher nicht
+// aus Interrupt-Routinen aufgerufen werden (dafuer ist PostEvent gedacht).
+type Topic[T any] struct {
+	name     string
+	disp     *Dispatcher
+	mu       sync.Mutex
+	subs     []*Subscription[T]
+	last     T
+	hasValue bool
+}
+
+// Funktionstyp der Abonnenten eines Topics.
+type SubscriberFunc[T any] func(v T)
+
+// Ein Abonnement eines Topics, wie es von Topic.Subscribe geliefert wird.
+type Subscription[T any] struct {
+	topic    *Topic[T]
+	fnc      SubscriberFunc[T]
+	isActive bool
+}
+
+// Erzeugt ein neues Topic mit Namen name. Die Ereignisse werden vom
+// Dispatcher d zugestellt (Default: Disp).
+func NewTopic[T any](name string, d *Dispatcher) *Topic[T] {
+	if d == nil {
+		d = Disp
+	}
+	return &Topic[T]{name: name, disp: d}
+}
+
+func (t *Topic[T]) Name() string {
+	return t.name
+}
+
+// Meldet fn fuer alle kuenftigen Ereignisse dieses Topics an.
+func (t *Topic[T]) Subscribe(fn SubscriberFunc[T]) *Subscription[T] {
+	s := &Subscription[T]{topic: t, fnc: fn, isActive: true}
+	t.mu.Lock()
+	// Die Liste wird bei jeder Aenderung neu angelegt, damit eine laufende
+	// Zustellung unbehelligt ueber die alte Liste iterieren kann.
+	subs := make([]*Subscription[T], len(t.subs), len(t.subs)+1)
+	copy(subs, t.subs)
+	t.subs = append(subs, s)
+	t.mu.Unlock()
+	return s
+}
+
+// Wie Subscribe, jedoch wird fn zusaetzlich (ebenfalls im Kontext des
+// Dispatchers) mit dem zuletzt publizierten Wert aufgerufen, sofern schon
+// einer publiziert wurde. Praktisch fuer Widgets, welche erst nach dem
+// ersten Ereignis erzeugt werden.
+func (t *Topic[T]) SubscribeLast(fn SubscriberFunc[T]) *Subscription[T] {
+	s := t.Subscribe(fn)
+	t.mu.Lock()
+	v, ok := t.last, t.hasValue
+	t.mu.Unlock()
+	if ok {
+		t.disp.Post(func() {
+			if s.Active() {
+				fn(v)
+			}
+		})
+	}
+	return s
+}
+
+// Meldet das Abonnement s ab. Ereignisse, welche bereits publiziert, aber
+// noch nicht zugestellt wurden, erhaelt s ebenfalls nicht mehr.
+func (t *Topic[T]) Unsubscribe(s *Subscription[T]) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, sub := range t.subs {
+		if sub == s {
+			subs := make([]*Subscription[T], 0, len(t.subs)-1)
+			subs = append(subs, t.subs[:i]...)
+			t.subs = append(subs, t.subs[i+1:]...)
+			s.isActive = false
+			return
+		}
+	}
+}
+
+// Liefert die Anzahl der Abonnenten.
+func (t *Topic[T]) NumSubscribers() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.subs)
+}
+
+// Liefert den zuletzt publizierten Wert. ok ist false, falls noch kein Wert
+// publiziert wurde.
+func (t *Topic[T]) Last() (v T, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last, t.hasValue
+}
+
+// Publiziert v an alle Abonnenten. Zugestellt wird an die Abonnenten,
+// welche zum Zeitpunkt der Zustellung angemeldet sind. Ist die Post-Queue
+// des Dispatchers voll, so wird das Ereignis verworfen und false
+// retourniert.
+func (t *Topic[T]) Publish(v T) bool {
+	t.mu.Lock()
+	t.last, t.hasValue = v, true
+	t.mu.Unlock()
+	return t.disp.Post(func() {
+		t.deliver(v)
+	})
+}
+
+func (t *Topic[T]) deliver(v T) {
+	t.mu.Lock()
+	subs := t.subs
+	t.mu.Unlock()
+	for _, s := range subs {
+		if s.Active() {
+			s.fnc(v)
+		}
+	}
+}
+
+// Beendet das Abonnement (siehe Topic.Unsubscribe).
+func (s *Subscription[T]) Cancel() {
+	s.topic.Unsubscribe(s)
+}
+
+// Liefert true, solange das Abonnement besteht.
+func (s *Subscription[T]) Active() bool {
+	s.topic.mu.Lock()
+	defer s.topic.mu.Unlock()
+	return s.isActive
+}
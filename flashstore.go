@@ -0,0 +1,15 @@
+//go:build !arduino_mega2560
+
+package tinylib
+
+import (
+	"machine"
+)
+
+// Erzeugt einen Store im Erase-Block Nummer block des Flash-Bereichs,
+// welcher auf das Programm folgt (siehe machine.Flash). Block 0 ist also
+// der erste Block nach dem Programm; er darf von keinem Filesystem o.ae.
+// verwendet werden.
+func NewFlashStore(block int64) *BlockStore {
+	return NewBlockStore(machine.Flash, block)
+}
@@ -0,0 +1,517 @@
+// Dieses Package enthaelt hierarchische Zustandsmaschinen (Statecharts) mit
+// Entry- und Exit-Aktionen, bewachten Uebergaengen, Timeouts und einer
+// Aufzeichnung der letzten Uebergaenge zur Fehlersuche. Nach dem Aufbau der
+// Maschine (New, State, On, ...) werden weder beim Verarbeiten von
+// Ereignissen noch bei Timeouts Speicher alloziert.
+//
+//	const (
+//	    EvPower fsm.Event = iota
+//	    EvBooted
+//	    EvTuned
+//	    EvAlarm
+//	)
+//
+//	m := fsm.New("radio", fsm.Config{Now: tinylib.Disp.Now})
+//	m.SetTimer(tinylib.NewTask(m.Timeout, tinylib.TaskConfig{Name: "radio"}))
+//	off := m.State("off", nil)
+//	on := m.State("on", nil).OnEntry(amp.Enable).OnExit(amp.Disable)
+//	booting := m.State("booting", on).OnEntry(dab.Boot).SetTimeout(5 * time.Second)
+//	scanning := m.State("scanning", on).OnEntry(dab.Scan)
+//	playing := m.State("playing", on)
+//	off.On(EvPower, on)
+//	on.On(EvPower, off)
+//	booting.On(EvBooted, scanning)
+//	booting.On(fsm.Timeout, off).Do(showBootError)
+//	scanning.On(EvTuned, playing).If(dab.HasServices)
+//	m.Start()
+//	...
+//	m.Dispatch(EvPower)
+//
+// Die Zeit fuer die Timeouts liefert Config.Now, abgelaufene Timeouts werden
+// mit der Methode Timeout verarbeitet, welche vom Timer (typischerweise ein
+// tinylib.Task) aufgerufen wird. Das Package selber ist reines Go und hat
+// keine Abhaengigkeiten zu tinylib.
+//
+// Eine Maschine ist nicht fuer den gleichzeitigen Zugriff aus mehreren
+// Goroutinen oder Kernen ausgelegt. Ereignisse aus Interrupt-Routinen oder
+// von anderen Kernen werden daher mit Dispatcher.Post bzw. PostEvent an den
+// Dispatcher uebergeben, welcher auch den Timer ausfuehrt.
+package fsm
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Ereignisse werden von der Applikation als Konstanten definiert.
+type Event uint16
+
+const (
+	// Pseudo-Ereignis, welches beim Ablauf des Timeouts eines Zustands
+	// ausgeloest wird (siehe State.SetTimeout).
+	Timeout Event = 0xffff
+	// Pseudo-Ereignis fuer den Eintrag von Start in der Aufzeichnung.
+	Init Event = 0xfffe
+)
+
+const (
+	// Anzahl Ereignisse, welche waehrend eines Uebergangs (bspw. aus einer
+	// Entry-Aktion) ausgeloest und danach verarbeitet werden koennen.
+	queueSize = 8
+	// Anzahl aufgezeichneter Uebergaenge (Default).
+	defTraceSize = 16
+)
+
+// Funktionstyp fuer Entry-, Exit- und Uebergangs-Aktionen.
+type Action func()
+
+// Funktionstyp fuer Bedingungen, unter welchen ein Uebergang erfolgt.
+type Guard func() bool
+
+// Das Einzige, was die Maschine fuer die Timeouts braucht. *tinylib.Task
+// erfuellt dieses Interface.
+type Timer interface {
+	Reschedule(delay time.Duration)
+	Cancel() bool
+}
+
+// Funktionstyp des Callback-Handlers fuer Uebergaenge.
+type TransitionCallback func(r Record)
+
+type Config struct {
+	// Zeitquelle fuer die Timeouts (Default: time.Now). Mit tinylib
+	// typischerweise Dispatcher.Now.
+	Now func() time.Time
+	// Anzahl aufgezeichneter Uebergaenge (Default: 16, -1: keine).
+	TraceSize int
+	// Namen der Ereignisse fuer WriteTrace, Index ist das Ereignis.
+	EventNames []string
+}
+
+// Ein aufgezeichneter Uebergang. Bei internen Uebergaengen ist To gleich
+// From.
+type Record struct {
+	Time     time.Time
+	Event    Event
+	From, To *State
+}
+
+type Machine struct {
+	name       string
+	now        func() time.Time
+	timer      Timer
+	isArmed    bool
+	eventNames []string
+	initial    *State
+	current    *State
+	isBusy     bool
+	queue      [queueSize]Event
+	qHead      int
+	qLen       int
+	overflows  uint32
+	trace      []Record
+	traceIdx   uint32
+	transCB    TransitionCallback
+}
+
+type State struct {
+	name        string
+	m           *Machine
+	parent      *State
+	initial     *State
+	depth       int
+	entry, exit Action
+	timeout     time.Duration
+	deadline    time.Time
+	transitions []*Transition
+}
+
+type Transition struct {
+	event  Event
+	target *State
+	guard  Guard
+	action Action
+}
+
+func New(name string, cfg Config) *Machine {
+	m := &Machine{name: name, now: cfg.Now, eventNames: cfg.EventNames}
+	if m.now == nil {
+		m.now = time.Now
+	}
+	if cfg.TraceSize == 0 {
+		cfg.TraceSize = defTraceSize
+	}
+	if cfg.TraceSize > 0 {
+		m.trace = make([]Record, cfg.TraceSize)
+	}
+	return m
+}
+
+func (m *Machine) Name() string {
+	return m.name
+}
+
+// Setzt den Timer, mit welchem die Timeouts der Zustaende realisiert
+// werden. Bei Ablauf muss er die Methode Timeout aufrufen. Ohne Timer
+// werden Timeouts nur bei expliziten Aufrufen von Timeout verarbeitet.
+func (m *Machine) SetTimer(t Timer) {
+	m.timer = t
+}
+
+// Setzt cb als Callback-Handler, welcher nach jedem Uebergang aufgerufen
+// wird (bspw. fuer ein Log).
+func (m *Machine) SetOnTransition(cb TransitionCallback) {
+	m.transCB = cb
+}
+
+// Erzeugt einen neuen Zustand mit Namen name als Unterzustand von parent
+// (nil fuer einen Zustand auf oberster Ebene). Der erste Zustand einer
+// Ebene ist deren Startzustand (siehe SetInitial).
+func (m *Machine) State(name string, parent *State) *State {
+	s := &State{name: name, m: m, parent: parent}
+	if parent != nil {
+		s.depth = parent.depth + 1
+		if parent.initial == nil {
+			parent.initial = s
+		}
+	} else if m.initial == nil {
+		m.initial = s
+	}
+	return s
+}
+
+// Legt s als Startzustand der obersten Ebene fest.
+func (m *Machine) SetInitial(s *State) {
+	m.initial = s
+}
+
+// Startet die Maschine, indem der Startzustand (und ggf. dessen
+// Startzustaende) betreten wird.
+func (m *Machine) Start() {
+	m.isBusy = true
+	from := m.current
+	if m.current != nil {
+		m.exitTo(nil)
+	}
+	m.current = m.enterInitial(m.enterPath(nil, m.initial))
+	m.record(Init, from, m.current)
+	m.isBusy = false
+	m.drain()
+	m.arm()
+}
+
+// Liefert den aktuellen (innersten) Zustand.
+func (m *Machine) Current() *State {
+	return m.current
+}
+
+// Liefert true, falls s der aktuelle Zustand oder einer seiner
+// uebergeordneten Zustaende ist.
+func (m *Machine) In(s *State) bool {
+	for c := m.current; c != nil; c = c.parent {
+		if c == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Verarbeitet das Ereignis ev. Gesucht wird ein Uebergang beim aktuellen
+// Zustand und danach bei den uebergeordneten Zustaenden; ausgefuehrt wird
+// der erste, dessen Bedingung erfuellt ist. Liefert false, falls kein
+// Uebergang passte. Wird Dispatch waehrend eines Uebergangs (bspw. aus
+// einer Aktion) aufgerufen, so wird ev erst nach dessen Abschluss
+// verarbeitet; in diesem Fall wird true retourniert, sofern ev nicht
+// wegen einer vollen Queue verworfen wurde.
+func (m *Machine) Dispatch(ev Event) bool {
+	if m.isBusy {
+		return m.enqueue(ev)
+	}
+	ok := m.process(m.current, ev)
+	m.drain()
+	m.arm()
+	return ok
+}
+
+// Liefert die Anzahl der Ereignisse, welche wegen einer vollen Queue
+// verworfen wurden.
+func (m *Machine) Overflows() uint32 {
+	return m.overflows
+}
+
+// Verarbeitet abgelaufene Timeouts. Sind mehrere aktive Zustaende
+// betroffen, so wird derjenige der aeussersten Ebene behandelt.
+func (m *Machine) Timeout() {
+	if m.isBusy {
+		return
+	}
+	m.isArmed = false
+	now := m.now()
+	var expired *State
+	for s := m.current; s != nil; s = s.parent {
+		if !s.deadline.IsZero() && !s.deadline.After(now) {
+			expired = s
+		}
+	}
+	if expired != nil {
+		expired.deadline = time.Time{}
+		m.fireFrom(expired, Timeout)
+		m.drain()
+	}
+	m.arm()
+}
+
+func (m *Machine) enqueue(ev Event) bool {
+	if m.qLen == queueSize {
+		m.overflows++
+		return false
+	}
+	m.queue[(m.qHead+m.qLen)%queueSize] = ev
+	m.qLen++
+	return true
+}
+
+func (m *Machine) drain() {
+	for m.qLen > 0 {
+		ev := m.queue[m.qHead]
+		m.qHead = (m.qHead + 1) % queueSize
+		m.qLen--
+		m.process(m.current, ev)
+	}
+}
+
+// Sucht ab dem Zustand from aufwaerts nach einem Uebergang fuer ev.
+func (m *Machine) process(from *State, ev Event) bool {
+	for s := from; s != nil; s = s.parent {
+		if m.fireFrom(s, ev) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fuehrt den ersten passenden Uebergang des Zustands src aus.
+func (m *Machine) fireFrom(src *State, ev Event) bool {
+	for _, tr := range src.transitions {
+		if tr.event != ev || (tr.guard != nil && !tr.guard()) {
+			continue
+		}
+		m.isBusy = true
+		from := m.current
+		if tr.target == nil {
+			if tr.action != nil {
+				tr.action()
+			}
+		} else {
+			lca := commonAncestor(src, tr.target)
+			if lca == tr.target {
+				lca = lca.parent
+			}
+			m.exitTo(lca)
+			if tr.action != nil {
+				tr.action()
+			}
+			m.current = m.enterInitial(m.enterPath(lca, tr.target))
+		}
+		m.record(ev, from, m.current)
+		m.isBusy = false
+		return true
+	}
+	return false
+}
+
+// Verlaesst alle Zustaende vom aktuellen bis ausschliesslich to.
+func (m *Machine) exitTo(to *State) {
+	for s := m.current; s != nil && s != to; s = s.parent {
+		s.deadline = time.Time{}
+		if s.exit != nil {
+			s.exit()
+		}
+		m.current = s.parent
+	}
+}
+
+// Betritt alle Zustaende unterhalb von from bis und mit to und liefert to.
+func (m *Machine) enterPath(from, to *State) *State {
+	if to == nil || to == from {
+		return to
+	}
+	m.enterPath(from, to.parent)
+	m.enter(to)
+	return to
+}
+
+// Betritt ab s die Startzustaende und liefert den innersten.
+func (m *Machine) enterInitial(s *State) *State {
+	for s != nil && s.initial != nil {
+		s = s.initial
+		m.enter(s)
+	}
+	return s
+}
+
+func (m *Machine) enter(s *State) {
+	m.current = s
+	if s.timeout > 0 {
+		s.deadline = m.now().Add(s.timeout)
+	}
+	if s.entry != nil {
+		s.entry()
+	}
+}
+
+// Stellt den Timer auf den naechsten Timeout der aktiven Zustaende.
+func (m *Machine) arm() {
+	if m.timer == nil {
+		return
+	}
+	var next time.Time
+	for s := m.current; s != nil; s = s.parent {
+		if !s.deadline.IsZero() && (next.IsZero() || s.deadline.Before(next)) {
+			next = s.deadline
+		}
+	}
+	if next.IsZero() {
+		if m.isArmed {
+			m.timer.Cancel()
+			m.isArmed = false
+		}
+		return
+	}
+	m.timer.Reschedule(max(next.Sub(m.now()), 0))
+	m.isArmed = true
+}
+
+func commonAncestor(a, b *State) *State {
+	for a.depth > b.depth {
+		a = a.parent
+	}
+	for b.depth > a.depth {
+		b = b.parent
+	}
+	for a != b {
+		a, b = a.parent, b.parent
+	}
+	return a
+}
+
+//----------------------------------------------------------------------------
+
+func (m *Machine) record(ev Event, from, to *State) {
+	r := Record{Time: m.now(), Event: ev, From: from, To: to}
+	if len(m.trace) > 0 {
+		m.trace[m.traceIdx%uint32(len(m.trace))] = r
+		m.traceIdx++
+	}
+	if m.transCB != nil {
+		m.transCB(r)
+	}
+}
+
+// Ruft fn fuer die aufgezeichneten Uebergaenge auf, beginnend mit dem
+// aeltesten.
+func (m *Machine) Trace(fn func(r Record)) {
+	size := uint32(len(m.trace))
+	first := uint32(0)
+	if m.traceIdx > size {
+		first = m.traceIdx - size
+	}
+	for i := first; i < m.traceIdx; i++ {
+		fn(m.trace[i%size])
+	}
+}
+
+// Schreibt die aufgezeichneten Uebergaenge in Textform nach w.
+func (m *Machine) WriteTrace(w io.Writer) error {
+	var err error
+	m.Trace(func(r Record) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, "%s %-10s %-12s -> %s\n",
+				r.Time.Format("15:04:05.000"), m.EventName(r.Event),
+				r.From.Name(), r.To.Name())
+		}
+	})
+	return err
+}
+
+// Liefert den Namen des Ereignisses ev gemaess Config.EventNames.
+func (m *Machine) EventName(ev Event) string {
+	switch {
+	case ev == Timeout:
+		return "timeout"
+	case ev == Init:
+		return "init"
+	case int(ev) < len(m.eventNames):
+		return m.eventNames[ev]
+	default:
+		return fmt.Sprintf("#%d", ev)
+	}
+}
+
+//----------------------------------------------------------------------------
+
+// Liefert den Namen des Zustands; fuer nil wird "-" retourniert.
+func (s *State) Name() string {
+	if s == nil {
+		return "-"
+	}
+	return s.name
+}
+
+func (s *State) Parent() *State {
+	return s.parent
+}
+
+// Setzt a als Aktion, welche beim Betreten des Zustands ausgefuehrt wird.
+func (s *State) OnEntry(a Action) *State {
+	s.entry = a
+	return s
+}
+
+// Setzt a als Aktion, welche beim Verlassen des Zustands ausgefuehrt wird.
+func (s *State) OnExit(a Action) *State {
+	s.exit = a
+	return s
+}
+
+// Verbleibt die Maschine laenger als d in diesem Zustand (bzw. in seinen
+// Unterzustaenden), so wird das Ereignis Timeout ausgeloest. Die
+// Uebergaenge dafuer werden mit On(fsm.Timeout, ...) festgelegt und nur
+// bei diesem Zustand gesucht.
+func (s *State) SetTimeout(d time.Duration) *State {
+	s.timeout = d
+	return s
+}
+
+// Legt sub als Startzustand dieses Zustands fest. Ohne Aufruf ist dies der
+// erste erzeugte Unterzustand.
+func (s *State) SetInitial(sub *State) *State {
+	s.initial = sub
+	return s
+}
+
+// Erzeugt einen Uebergang, welcher beim Ereignis ev in den Zustand target
+// fuehrt. Mit target gleich s wird der Zustand verlassen und neu betreten,
+// mit target nil erfolgt ein interner Uebergang, bei welchem nur die
+// Aktion ausgefuehrt wird. Ist target ein zusammengesetzter Zustand, so
+// werden anschliessend dessen Startzustaende betreten.
+func (s *State) On(ev Event, target *State) *Transition {
+	tr := &Transition{event: ev, target: target}
+	s.transitions = append(s.transitions, tr)
+	return tr
+}
+
+// Der Uebergang erfolgt nur, wenn g true liefert. Andernfalls wird nach
+// weiteren Uebergaengen fuer das Ereignis gesucht.
+func (tr *Transition) If(g Guard) *Transition {
+	tr.guard = g
+	return tr
+}
+
+// Setzt a als Aktion des Uebergangs. Sie wird nach den Exit- und vor den
+// Entry-Aktionen ausgefuehrt.
+func (tr *Transition) Do(a Action) *Transition {
+	tr.action = a
+	return tr
+}
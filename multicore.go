@@ -0,0 +1,141 @@
+//go:build inline
+
+package tinylib
+
+import (
+	"context"
+	"runtime"
+)
+
+// Auf Microcontrollern mit mehreren Kernen (bspw. RP2040 oder RP2350) kann
+// pro Kern ein Dispatcher betrieben werden. Die Dispatcher in Cores sind an
+// ihren Kern gebunden, d.h. Tick fuehrt nur dann Tasks aus, wenn es auf dem
+// entsprechenden Kern aufgerufen wird. Da TinyGo Goroutinen keinem festen
+// Kern zuordnet, gibt ein Dispatcher, dessen Tick auf dem falschen Kern
+// aufgerufen wird, den Prozessor mit runtime.Gosched() wieder frei.
+//
+// Eine Aufteilung in Darstellung (Kern 1) und Eingabe/DAB (Kern 0) sieht
+// bspw. so aus:
+//
+//	tinylib.AddTask(tinylib.NewTask(btn.Tick, tinylib.TaskConfig{
+//	    Interval: 10 * time.Millisecond,
+//	}))
+//	tinylib.AddTask(tinylib.NewTask(screen.Render, tinylib.TaskConfig{
+//	    Interval: 40 * time.Millisecond,
+//	    Core:     1,
+//	}))
+//	tinylib.RunCores()
+//
+// Damit Kern 1 tatsaechlich genutzt wird, muss das Programm mit dem
+// Scheduler 'cores' uebersetzt werden (tinygo build -scheduler=cores ...,
+// ab TinyGo 0.34). Mit den Schedulern 'tasks' oder 'none' laufen alle
+// Goroutinen auf Kern 0; RunCores erkennt dies (siehe AvailableCores) und
+// fuehrt dann alle Dispatcher auf Kern 0 aus.
+//
+// Fuer die Kommunikation zwischen den Kernen ist PostTo zu verwenden, da
+// die Dispatcher selber nicht synchronisiert sind.
+var (
+	// Pro Prozessorkern ein Dispatcher. Cores[0] ist identisch mit Disp.
+	Cores [NumCores]*Dispatcher
+)
+
+// Bindet den Dispatcher an den Kern core. Mit core < 0 wird die Bindung
+// aufgehoben.
+func (d *Dispatcher) BindCore(core int) {
+	d.core = core
+}
+
+// Liefert den Kern, an welchen der Dispatcher gebunden ist oder -1, falls
+// er nicht gebunden ist.
+func (d *Dispatcher) Core() int {
+	return d.core
+}
+
+// Liefert die Anzahl Kerne, welche dem Programm tatsaechlich zur Verfuegung
+// stehen. Ohne den Scheduler 'cores' ist dies immer 1, auch wenn der
+// Microcontroller mehrere Kerne besitzt.
+func AvailableCores() int {
+	return min(runtime.NumCPU(), NumCores)
+}
+
+// Startet die Dispatcher aller Kerne und kehrt erst zurueck, wenn Disp mit
+// Stop angehalten wird. Die Dispatcher der weiteren Kerne laufen in eigenen
+// Goroutinen, welche vom Scheduler 'cores' auf die Kerne verteilt werden;
+// ein Dispatcher, der auf dem falschen Kern landet, gibt den Prozessor so
+// lange ab, bis er auf seinem Kern laeuft. Stehen nicht alle Kerne zur
+// Verfuegung, so wird die Kern-Bindung aller Dispatcher aufgehoben und
+// ihre Ticks werden abwechselnd auf dem aktuellen Kern ausgefuehrt.
+func RunCores() {
+	if AvailableCores() < NumCores {
+		for _, d := range Cores {
+			d.BindCore(-1)
+		}
+		for !Disp.isStopped {
+			for _, d := range Cores {
+				if !d.isStopped {
+					d.Tick()
+				}
+			}
+		}
+		return
+	}
+	for _, d := range Cores[1:] {
+		go d.Run()
+	}
+	Disp.Run()
+}
+
+// Ruft Tick in einer Schleife auf, bis der Dispatcher mit Stop angehalten
+// wird.
+func (d *Dispatcher) Run() {
+	d.isRunning.Store(true)
+	defer d.isRunning.Store(false)
+	for !d.isStopped {
+		d.Tick()
+	}
+}
+
+// Beendet die Schleife in Run nach dem aktuellen Tick. Da die Tasks
+// kooperativ ausgefuehrt werden, muss auf keinen laufenden Task gewartet
+// werden; ctx wird nur der Kompatibilitaet mit dem Dispatcher aus
+// dispatcher_goroutine.go wegen akzeptiert und es wird immer nil retourniert.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.isStopped = true
+	return nil
+}
+
+// Prueft, ob der Dispatcher auf dem aktuellen Kern Tasks ausfuehren darf.
+// Falls nicht, wird der Prozessor an andere Goroutinen abgegeben.
+func (d *Dispatcher) onCore() bool {
+	if d.core < 0 || d.core == currentCore() {
+		return true
+	}
+	runtime.Gosched()
+	return false
+}
+
+// Fuegt den Task t dem Dispatcher des Kerns hinzu, der in TaskConfig.Core
+// angegeben wurde. Gibt es diesen Kern nicht, wird Kern 0 verwendet. Im
+// Gegensatz zu Dispatcher.AddTask darf diese Funktion von jedem Kern aus
+// aufgerufen werden. Laeuft der Dispatcher eines anderen Kerns bereits (mit
+// Run bzw. RunCores), so wird t ueber seine Post-Queue uebergeben; ist diese
+// voll, so wird false retourniert und t nicht hinzugefuegt. Vor dem Start
+// der Dispatcher (d.h. waehrend der Initialisierung auf Kern 0) wird t
+// direkt hinzugefuegt, die Anzahl Tasks ist damit nicht beschraenkt.
+func AddTask(t *Task) bool {
+	d := Disp
+	if int(t.core) < NumCores {
+		d = Cores[t.core]
+	}
+	if d.core < 0 || d.core == currentCore() || !d.isRunning.Load() {
+		d.AddTask(t)
+		return true
+	}
+	return d.Post(func() { d.AddTask(t) })
+}
+
+// Uebergibt fn an den Dispatcher des Kerns core (siehe Dispatcher.Post).
+// Darf von jedem Kern und aus Interrupt-Routinen aufgerufen werden.
+func PostTo(core int, fn func()) bool {
+	return Cores[core].Post(fn)
+}
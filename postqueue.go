@@ -0,0 +1,95 @@
+package tinylib
+
+import (
+	"sync/atomic"
+)
+
+const (
+	// Anzahl Eintraege in der Post-Queue eines Dispatchers. Muss eine
+	// Zweierpotenz sein.
+	postQueueSize = 32
+	postQueueMask = postQueueSize - 1
+)
+
+// Funktionstyp fuer Ereignisse, welche mit Dispatcher.PostEvent aus einer
+// Interrupt-Routine an den Dispatcher uebergeben werden. Mit arg kann ein
+// beliebiger Wert (Pin-Nummer, Zaehlerstand, etc.) mitgegeben werden, ohne
+// dass dafuer in der Interrupt-Routine eine Closure erzeugt werden muss.
+type EventFunc func(arg uint32)
+
+type postEntry struct {
+	seq atomic.Uint32
+	fn  func()
+	efn EventFunc
+	arg uint32
+}
+
+// Eine Ringpuffer-Queue mit fester Groesse, in welche aus beliebigem Kontext
+// (insbesondere aus Interrupt-Routinen) ohne Locks geschrieben werden kann.
+// Gelesen wird nur vom Dispatcher. Die Implementation folgt der bekannten
+// "bounded MPMC queue" von D. Vyukov: jeder Eintrag fuehrt eine Sequenz-
+// nummer, an welcher Schreiber und Leser erkennen, ob der Eintrag frei bzw.
+// gefuellt ist.
+type postQueue struct {
+	entries    [postQueueSize]postEntry
+	head, tail atomic.Uint32
+	overflows  atomic.Uint32
+}
+
+func (q *postQueue) init() {
+	for i := range q.entries {
+		q.entries[i].seq.Store(uint32(i))
+	}
+}
+
+// Stellt fn bzw. efn mit arg in die Queue. Ist die Queue voll, wird der
+// Ueberlauf gezaehlt und false retourniert.
+func (q *postQueue) put(fn func(), efn EventFunc, arg uint32) bool {
+	var e *postEntry
+
+	pos := q.tail.Load()
+	for {
+		e = &q.entries[pos&postQueueMask]
+		dif := int32(e.seq.Load() - pos)
+		if dif == 0 {
+			if q.tail.CompareAndSwap(pos, pos+1) {
+				break
+			}
+			pos = q.tail.Load()
+		} else if dif < 0 {
+			q.overflows.Add(1)
+			return false
+		} else {
+			pos = q.tail.Load()
+		}
+	}
+	e.fn, e.efn, e.arg = fn, efn, arg
+	e.seq.Store(pos + 1)
+	return true
+}
+
+// Entnimmt den aeltesten Eintrag und fuehrt ihn aus. Liefert false, falls
+// die Queue leer ist.
+func (q *postQueue) runNext() bool {
+	pos := q.head.Load()
+	e := &q.entries[pos&postQueueMask]
+	if int32(e.seq.Load()-(pos+1)) < 0 {
+		return false
+	}
+	fn, efn, arg := e.fn, e.efn, e.arg
+	e.fn, e.efn = nil, nil
+	q.head.Store(pos + 1)
+	e.seq.Store(pos + postQueueSize)
+	if fn != nil {
+		fn()
+	} else if efn != nil {
+		efn(arg)
+	}
+	return true
+}
+
+// Liefert true, falls kein Eintrag zur Ausfuehrung bereit steht.
+func (q *postQueue) empty() bool {
+	pos := q.head.Load()
+	return int32(q.entries[pos&postQueueMask].seq.Load()-(pos+1)) < 0
+}
@@ -0,0 +1,77 @@
+package tinylib
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestPostQueueConcurrent(t *testing.T) {
+	const numWriters, numPosts = 4, 1000
+
+	var q postQueue
+	q.init()
+	next := make([]uint32, numWriters)
+	numRecv := 0
+	recv := func(arg uint32) {
+		w, i := arg>>16, arg&0xffff
+		if i != next[w] {
+			t.Errorf("writer %d: got post %d, want %d", w, i, next[w])
+		}
+		next[w] = i + 1
+		numRecv++
+	}
+
+	var wg sync.WaitGroup
+	for w := range numWriters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range numPosts {
+				for !q.put(nil, recv, uint32(w<<16|i)) {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		for q.runNext() {
+		}
+		runtime.Gosched()
+	}
+	for q.runNext() {
+	}
+	if numRecv != numWriters*numPosts {
+		t.Fatalf("got %d posts, want %d", numRecv, numWriters*numPosts)
+	}
+}
+
+func TestPostQueueOverflow(t *testing.T) {
+	d := NewDispatcher()
+	for i := range postQueueSize {
+		if !d.Post(func() {}) {
+			t.Fatalf("post %d rejected", i)
+		}
+	}
+	for range 3 {
+		if d.Post(func() {}) {
+			t.Fatal("post into full queue accepted")
+		}
+	}
+	if n := d.PostOverflows(); n != 3 {
+		t.Fatalf("got %d overflows, want 3", n)
+	}
+	if !d.posts.runNext() || !d.Post(func() {}) {
+		t.Fatal("no room after taking one entry")
+	}
+}
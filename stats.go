@@ -0,0 +1,112 @@
+package tinylib
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Momentaufnahme der statistischen Daten eines Tasks (siehe Task.Stats).
+type TaskStats struct {
+	Name                       string
+	State                      TaskState
+	Interval                   time.Duration
+	NumCalls                   uint32
+	AvgTerm, MinTerm, MaxTerm  time.Duration
+	AvgDelay, MaxDelay, Jitter time.Duration
+	NumMissed, NumOverruns     uint32
+	// Anteil an der CPU-Zeit im letzten vollstaendigen Messfenster in
+	// Prozent.
+	CPUShare float32
+	// Anzahl Aufrufe pro Sekunde im letzten vollstaendigen Messfenster.
+	CallsPerSec float32
+}
+
+// Momentaufnahme der statistischen Daten eines Dispatchers (siehe
+// Dispatcher.Stats).
+type DispatcherStats struct {
+	// Zeitpunkt der Momentaufnahme (Zeit der Dispatcher-Uhr).
+	Time time.Time
+	// Laenge des Messfensters fuer Load und CPUShare.
+	Window time.Duration
+	// Systemlast in Prozent (siehe Dispatcher.Load).
+	Load uint8
+	// Anzahl der eingeplanten Tasks.
+	NumTasks int
+	// Anzahl der wegen voller Queue verworfenen Aufrufe von Post.
+	PostOverflows uint32
+	Tasks         []TaskStats
+}
+
+// Ausgabeformate fuer DispatcherStats.Write.
+type StatsFormat int
+
+const (
+	StatsText StatsFormat = iota
+	StatsCSV
+)
+
+// Schreibt die Statistik im Format format auf w. Im Textformat wird eine
+// kleine Tabelle erstellt, im CSV-Format eine Kopfzeile und eine Zeile pro
+// Task.
+func (s *DispatcherStats) Write(w io.Writer, format StatsFormat) error {
+	switch format {
+	case StatsCSV:
+		return s.writeCSV(w)
+	default:
+		return s.writeText(w)
+	}
+}
+
+func (s *DispatcherStats) writeText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "load: %d%% (window %v), tasks: %d scheduled, %d total, post overflows: %d\n",
+		s.Load, s.Window, s.NumTasks, len(s.Tasks), s.PostOverflows)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%-16s %-9s %8s %8s %9s %9s %9s %9s %9s %6s %6s %6s %7s\n",
+		"name", "state", "interval", "calls", "avg term", "max term",
+		"avg delay", "max delay", "jitter", "missed", "overr.", "cpu%", "calls/s")
+	if err != nil {
+		return err
+	}
+	for _, t := range s.Tasks {
+		_, err = fmt.Fprintf(w, "%-16s %-9s %8v %8d %9v %9v %9v %9v %9v %6d %6d %6.2f %7.2f\n",
+			t.Name, t.State, t.Interval, t.NumCalls, t.AvgTerm, t.MaxTerm,
+			t.AvgDelay, t.MaxDelay, t.Jitter, t.NumMissed, t.NumOverruns,
+			t.CPUShare, t.CallsPerSec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DispatcherStats) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "state", "interval_us", "calls", "avg_term_us",
+		"min_term_us", "max_term_us", "avg_delay_us", "max_delay_us",
+		"jitter_us", "missed", "overruns", "cpu_share", "calls_per_sec"})
+	for _, t := range s.Tasks {
+		cw.Write([]string{
+			t.Name,
+			t.State.String(),
+			strconv.FormatInt(t.Interval.Microseconds(), 10),
+			strconv.FormatUint(uint64(t.NumCalls), 10),
+			strconv.FormatInt(t.AvgTerm.Microseconds(), 10),
+			strconv.FormatInt(t.MinTerm.Microseconds(), 10),
+			strconv.FormatInt(t.MaxTerm.Microseconds(), 10),
+			strconv.FormatInt(t.AvgDelay.Microseconds(), 10),
+			strconv.FormatInt(t.MaxDelay.Microseconds(), 10),
+			strconv.FormatInt(t.Jitter.Microseconds(), 10),
+			strconv.FormatUint(uint64(t.NumMissed), 10),
+			strconv.FormatUint(uint64(t.NumOverruns), 10),
+			strconv.FormatFloat(float64(t.CPUShare), 'f', 2, 32),
+			strconv.FormatFloat(float64(t.CallsPerSec), 'f', 2, 32),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
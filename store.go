@@ -0,0 +1,96 @@
+package tinylib
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// Ein kleiner, persistenter Speicherbereich fuer einen einzelnen Datensatz
+// (Diagnose, Kalibrierung, etc.), dessen Inhalt einen Neustart des
+// Microcontrollers ueberdauert.
+type Store interface {
+	// Liest den gespeicherten Datensatz nach p und liefert dessen Laenge.
+	// Ist nichts (oder nichts Gueltiges) gespeichert, so wird ErrNoData
+	// retourniert.
+	Load(p []byte) (n int, err error)
+	// Ersetzt den gespeicherten Datensatz durch p.
+	Save(p []byte) error
+}
+
+var (
+	ErrNoData   = errors.New("tinylib: no valid data in store")
+	ErrTooLarge = errors.New("tinylib: data too large for store")
+)
+
+// Die Schnittstelle eines blockorientierten Speichers, wie ihn bspw.
+// machine.Flash anbietet.
+type BlockDevice interface {
+	ReadAt(p []byte, off int64) (n int, err error)
+	WriteAt(p []byte, off int64) (n int, err error)
+	WriteBlockSize() int64
+	EraseBlockSize() int64
+	EraseBlocks(start, len int64) error
+}
+
+const (
+	blockStoreMagic   = 0x544c
+	blockStoreHdrSize = 8
+)
+
+// Implementiert Store auf einem einzelnen Erase-Block eines BlockDevice.
+// Dem Datensatz wird ein Header mit Kennung, Laenge und CRC-32 vorangestellt,
+// damit ein leerer oder beim Schreiben unterbrochener Block erkannt wird.
+type BlockStore struct {
+	dev   BlockDevice
+	block int64
+}
+
+// Erzeugt einen Store im Erase-Block Nummer block von dev. Der Block muss
+// fuer diesen Zweck reserviert sein.
+func NewBlockStore(dev BlockDevice, block int64) *BlockStore {
+	return &BlockStore{dev: dev, block: block}
+}
+
+func (s *BlockStore) Load(p []byte) (int, error) {
+	var hdr [blockStoreHdrSize]byte
+	off := s.block * s.dev.EraseBlockSize()
+	if _, err := s.dev.ReadAt(hdr[:], off); err != nil {
+		return 0, err
+	}
+	if binary.LittleEndian.Uint16(hdr[0:]) != blockStoreMagic {
+		return 0, ErrNoData
+	}
+	n := int(binary.LittleEndian.Uint16(hdr[2:]))
+	if n > len(p) || int64(n) > s.dev.EraseBlockSize()-blockStoreHdrSize {
+		return 0, ErrNoData
+	}
+	if _, err := s.dev.ReadAt(p[:n], off+blockStoreHdrSize); err != nil {
+		return 0, err
+	}
+	if crc32.ChecksumIEEE(p[:n]) != binary.LittleEndian.Uint32(hdr[4:]) {
+		return 0, ErrNoData
+	}
+	return n, nil
+}
+
+func (s *BlockStore) Save(p []byte) error {
+	size := int64(blockStoreHdrSize + len(p))
+	if size > s.dev.EraseBlockSize() || len(p) > 0xffff {
+		return ErrTooLarge
+	}
+	wbs := s.dev.WriteBlockSize()
+	buf := make([]byte, (size+wbs-1)/wbs*wbs)
+	for i := range buf {
+		buf[i] = 0xff
+	}
+	binary.LittleEndian.PutUint16(buf[0:], blockStoreMagic)
+	binary.LittleEndian.PutUint16(buf[2:], uint16(len(p)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(p))
+	copy(buf[blockStoreHdrSize:], p)
+	if err := s.dev.EraseBlocks(s.block, 1); err != nil {
+		return err
+	}
+	_, err := s.dev.WriteAt(buf, s.block*s.dev.EraseBlockSize())
+	return err
+}
@@ -0,0 +1,499 @@
+package tinylib
+
+import (
+	"time"
+)
+
+// Ist eine Alternative zu time.Now(), welche die aktuelle Zeit auf
+// Millisekunden genau liefert. Als Zeitquelle wird die Uhr des Default-
+// Dispatchers verwendet (siehe Dispatcher.SetClock).
+func Now() time.Time {
+	return Disp.Now()
+}
+
+func NowMS() int64 {
+	return Now().UnixMilli()
+}
+
+//----------------------------------------------------------------------------
+
+// Jede Funktion/Methode dieses Typs kann in einem Task hinterlegt und
+// periodisch durch den Dispatcher aufgerufen werden.
+type TaskFunc func()
+
+// Funktionen dieses Typs koennen mit NewAdaptiveTask als Task hinterlegt
+// werden. Der Rueckgabewert bestimmt die Zeitspanne bis zur naechsten
+// Ausfuehrung und wird zum neuen Intervall des Tasks. Mit 0 bleibt das
+// bisherige Intervall bestehen, mit StopTask wird der Task beendet. Damit
+// lassen sich bspw. Abfragen realisieren, welche sich bei Inaktivitaet
+// zunehmend seltener ausfuehren lassen.
+type AdaptiveTaskFunc func() time.Duration
+
+// Rueckgabewert einer AdaptiveTaskFunc, um den Task zu beenden.
+const StopTask time.Duration = -1
+
+// Legt fest, wie der naechste Ausfuehrungszeitpunkt eines periodischen
+// Tasks berechnet wird.
+//
+//	FixedDelay: Interval wird ab dem Zeitpunkt der letzten Ausfuehrung
+//	            gerechnet, Verspaetungen verschieben den Takt dauerhaft.
+//	FixedRate : Interval wird ab dem geplanten Zeitpunkt der letzten
+//	            Ausfuehrung gerechnet, der Task bleibt phasenstarr.
+type ScheduleMode uint8
+
+const (
+	FixedDelay ScheduleMode = iota
+	FixedRate
+)
+
+// Bestimmt bei FixedRate, wie mit verpassten Perioden umgegangen wird.
+//
+//	CatchUpSkip : verpasste Perioden werden uebersprungen
+//	CatchUpOnce : verpasste Perioden werden durch eine einzige, sofortige
+//	              Ausfuehrung nachgeholt
+//	CatchUpBurst: jede verpasste Periode wird nachgeholt
+type CatchUpPolicy uint8
+
+const (
+	CatchUpSkip CatchUpPolicy = iota
+	CatchUpOnce
+	CatchUpBurst
+)
+
+// Mit ExecTime kann der Zeitpunkt der ersten Ausfuehrung festgelegt werden.
+// Bleibt das Feld leer, wird der Task erstmals nach Ablauf von Interval
+// ausgefuehrt. Liegt ExecTime in der Vergangenheit, so wird der Task beim
+// naechsten Aufruf von Dispatcher.Tick ausgefuehrt. ExecTime gilt nur fuer
+// das erste Hinzufuegen; wird der Task spaeter (nach Halt oder RemoveTask)
+// erneut hinzugefuegt, so wird er wiederum erst nach Ablauf von Interval
+// ausgefuehrt. Ein Task mit Interval 0 wird genau einmal ausgefuehrt.
+type TaskConfig struct {
+	ExecTime time.Time
+	Interval time.Duration
+	// Art der Berechnung des naechsten Ausfuehrungszeitpunktes (Default:
+	// FixedDelay).
+	Mode ScheduleMode
+	// Umgang mit verpassten Perioden bei Mode FixedRate (Default:
+	// CatchUpSkip).
+	CatchUp CatchUpPolicy
+	// Name des Tasks, wird nur fuer Statistiken und Diagnosen verwendet.
+	Name string
+	// Nummer des Prozessorkerns, auf welchem der Task ausgefuehrt werden
+	// soll. Wird nur von der Funktion AddTask beruecksichtigt.
+	Core uint8
+	// Maximal erlaubte Laufzeit einer einzelnen Ausfuehrung. Wird sie
+	// ueberschritten, so wird der Overrun-Callback aufgerufen (Default: 0,
+	// d.h. keine Ueberwachung).
+	Budget time.Duration
+}
+
+// Funktionstyp des Callback-Handlers, welcher aufgerufen wird, wenn ein Task
+// sein Budget ueberschritten hat. term ist die gemessene Laufzeit.
+type OverrunCallback func(t *Task, term time.Duration)
+
+// Jeder Task befindet sich zu jedem Zeitpunkt in genau einem dieser
+// Zustaende.
+//
+//	TaskIdle     : noch nie eingeplant oder einmaliger Task abgearbeitet
+//	TaskScheduled: wartet beim Dispatcher auf seine Ausfuehrung
+//	TaskRunning  : wird gerade ausgefuehrt
+//	TaskPaused   : angehalten, kann mit Dispatcher.Resume fortgesetzt werden
+//	TaskRemoved  : wurde aus dem Dispatcher entfernt
+type TaskState uint8
+
+const (
+	TaskIdle TaskState = iota
+	TaskScheduled
+	TaskRunning
+	TaskPaused
+	TaskRemoved
+)
+
+func (s TaskState) String() string {
+	switch s {
+	case TaskIdle:
+		return "Idle"
+	case TaskScheduled:
+		return "Scheduled"
+	case TaskRunning:
+		return "Running"
+	case TaskPaused:
+		return "Paused"
+	case TaskRemoved:
+		return "Removed"
+	default:
+		return "(unspec. task state)"
+	}
+}
+
+type Task struct {
+	Func                  TaskFunc
+	adaptFunc             AdaptiveTaskFunc
+	isStopping            bool
+	core                  uint8
+	name                  string
+	disp                  *Dispatcher
+	isRegistered          bool
+	execTime              time.Time
+	hasStartTime          bool
+	interval              time.Duration
+	mode                  ScheduleMode
+	catchUp               CatchUpPolicy
+	heapIdx               int
+	seq                   uint32
+	state                 TaskState
+	lastTerm, term, delay time.Duration
+	minTerm, maxTerm      time.Duration
+	lastDelay, maxDelay   time.Duration
+	jitter                time.Duration
+	numCalls              uint32
+	numMissed             uint32
+	budget                time.Duration
+	numOverruns           uint32
+	overrunCB             OverrunCallback
+	winIdx                int64
+	winTerm, prevWinTerm  time.Duration
+	winCalls, prevCalls   uint32
+	traceID               uint16
+}
+
+func NewTask(fnc TaskFunc, cfg TaskConfig) *Task {
+	t := &Task{}
+	t.Func = fnc
+	t.Configure(cfg)
+	return t
+}
+
+// Erzeugt einen Task, dessen Funktion bei jedem Aufruf die Zeitspanne bis
+// zur naechsten Ausfuehrung bestimmt (siehe AdaptiveTaskFunc). Das Intervall
+// in cfg bestimmt den Zeitpunkt der ersten Ausfuehrung.
+func NewAdaptiveTask(fnc AdaptiveTaskFunc, cfg TaskConfig) *Task {
+	t := &Task{}
+	t.adaptFunc = fnc
+	t.Configure(cfg)
+	return t
+}
+
+func (t *Task) Configure(cfg TaskConfig) {
+	t.name = cfg.Name
+	t.core = cfg.Core
+	t.execTime = cfg.ExecTime
+	t.hasStartTime = !cfg.ExecTime.IsZero()
+	t.interval = cfg.Interval
+	t.mode = cfg.Mode
+	t.catchUp = cfg.CatchUp
+	t.budget = cfg.Budget
+}
+
+// Setzt cb als Callback-Handler, welcher bei einer Ueberschreitung des
+// Budgets aufgerufen wird.
+func (t *Task) SetOnOverrun(cb OverrunCallback) {
+	t.overrunCB = cb
+}
+
+func (t *Task) Start(now time.Time) {
+	delay := now.Sub(t.execTime)
+	clock := t.dispatcher().clock
+	t0 := clock.Now()
+	next := t.call()
+	t1 := clock.Now()
+	if t.finish(now, t1, delay, t1.Sub(t0), next) && t.overrunCB != nil {
+		t.overrunCB(t, t.lastTerm)
+	}
+}
+
+// Schliesst eine Ausfuehrung ab, welche zum Zeitpunkt start gestartet und
+// zum Zeitpunkt end beendet wurde: Statistik nachfuehren, Budget pruefen
+// und den naechsten Ausfuehrungszeitpunkt berechnen. delay ist die
+// Verspaetung, term die Laufzeit und next der Rueckgabewert von call.
+// Liefert true, falls das Budget ueberschritten wurde; der Overrun-Callback
+// muss vom Aufrufer ausgefuehrt werden.
+func (t *Task) finish(start, end time.Time, delay, term, next time.Duration) bool {
+	t.adapt(next)
+	t.lastTerm = term
+	t.updateStats(delay)
+	overrun := t.budget > 0 && t.lastTerm > t.budget
+	if overrun {
+		t.numOverruns += 1
+	}
+	if t.state != TaskScheduled {
+		t.execTime = t.nextExecTime(start, end.Truncate(time.Millisecond))
+	}
+	return overrun
+}
+
+// Berechnet den naechsten Ausfuehrungszeitpunkt gemaess Mode und CatchUp.
+// start ist der Zeitpunkt, zu welchem die aktuelle Ausfuehrung gestartet
+// wurde, end derjenige, zu welchem sie beendet war.
+func (t *Task) nextExecTime(start, end time.Time) time.Time {
+	if t.mode == FixedDelay || t.interval == 0 {
+		return start.Add(t.interval)
+	}
+	next := t.execTime.Add(t.interval)
+	if next.After(end) || t.catchUp == CatchUpBurst {
+		return next
+	}
+	missed := end.Sub(next) / t.interval
+	if t.catchUp == CatchUpOnce {
+		return next.Add(missed * t.interval)
+	}
+	return next.Add((missed + 1) * t.interval)
+}
+
+func (t *Task) Run() {
+	t.adapt(t.call())
+}
+
+// Fuehrt die Funktion des Tasks aus und liefert bei adaptiven Tasks die
+// gewuenschte Zeitspanne bis zur naechsten Ausfuehrung (sonst 0).
+func (t *Task) call() time.Duration {
+	if t.adaptFunc == nil {
+		t.Func()
+		return 0
+	}
+	return t.adaptFunc()
+}
+
+// Uebernimmt den Rueckgabewert einer AdaptiveTaskFunc.
+func (t *Task) adapt(next time.Duration) {
+	t.isStopping = next < 0
+	if next > 0 {
+		t.interval = next
+	}
+}
+
+// Aktualisiert die Statistik nach einer Ausfuehrung. delay ist die
+// Verspaetung gegenueber dem geplanten Ausfuehrungszeitpunkt, die Laufzeit
+// muss bereits in lastTerm stehen. Als Jitter wird der geglaettete Betrag
+// der Aenderung der Verspaetung gefuehrt (analog RFC 3550). Ein Deadline-
+// Miss liegt vor, wenn ein periodischer Task erst nach dem Beginn seiner
+// naechsten Periode fertig wird.
+func (t *Task) updateStats(delay time.Duration) {
+	t.numCalls += 1
+	t.term += t.lastTerm
+	t.delay += delay
+	if t.numCalls == 1 || t.lastTerm < t.minTerm {
+		t.minTerm = t.lastTerm
+	}
+	if t.lastTerm > t.maxTerm {
+		t.maxTerm = t.lastTerm
+	}
+	if delay > t.maxDelay {
+		t.maxDelay = delay
+	}
+	if t.numCalls > 1 {
+		diff := delay - t.lastDelay
+		if diff < 0 {
+			diff = -diff
+		}
+		t.jitter += (diff - t.jitter) / 16
+	}
+	t.lastDelay = delay
+	if t.interval > 0 && delay+t.lastTerm > t.interval {
+		t.numMissed += 1
+	}
+}
+
+// Bestimmt beim Hinzufuegen zum Dispatcher den ersten Ausfuehrungszeitpunkt:
+// ExecTime aus der Konfiguration (nur beim ersten Mal), sonst now+Interval.
+func (t *Task) planStart(now time.Time) {
+	if !t.hasStartTime {
+		t.execTime = now.Add(t.interval)
+	}
+	t.hasStartTime = false
+}
+
+// Ueberspringt beim Fortsetzen nach einer Pause alle Perioden, welche
+// waehrend der Pause verstrichen sind - unabhaengig von CatchUp, welches
+// nur fuer Ueberlaeufe gedacht ist.
+func (t *Task) skipElapsed(now time.Time) {
+	if t.interval <= 0 || !t.execTime.Before(now) {
+		return
+	}
+	n := (now.Sub(t.execTime) + t.interval - 1) / t.interval
+	t.execTime = t.execTime.Add(n * t.interval)
+}
+
+// Liefert den Dispatcher, bei welchem der Task registriert ist oder den
+// Default-Dispatcher, falls der Task noch nie hinzugefuegt wurde.
+func (t *Task) dispatcher() *Dispatcher {
+	if t.disp != nil {
+		return t.disp
+	}
+	return Disp
+}
+
+// Liefert den Namen des Tasks.
+func (t *Task) Name() string {
+	return t.name
+}
+
+// Liefert den aktuellen Zustand des Tasks.
+func (t *Task) State() TaskState {
+	return t.dispatcher().taskState(t)
+}
+
+// Haelt den Task an, indem er aus dem Dispatcher entfernt wird. Mit
+// Dispatcher.AddTask kann er wieder gestartet werden.
+func (t *Task) Halt() {
+	t.dispatcher().RemoveTask(t)
+}
+
+// Entfernt den Task aus dem Dispatcher, ohne dass er nochmals ausgefuehrt
+// wird. Liefert true, falls der Task zu diesem Zeitpunkt noch ausstehend
+// war. Der Task kann spaeter mit Reschedule wieder aktiviert werden.
+func (t *Task) Cancel() bool {
+	pending := t.Pending()
+	t.dispatcher().RemoveTask(t)
+	return pending
+}
+
+// Plant den Task neu, so dass er nach Ablauf von delay (erneut) ausgefuehrt
+// wird. Ist der Task bereits ausstehend, so wird nur der Ausfuehrungs-
+// zeitpunkt verschoben. Die Methode kann auch innerhalb des Tasks selber
+// aufgerufen werden.
+func (t *Task) Reschedule(delay time.Duration) {
+	t.dispatcher().reschedule(t, delay)
+}
+
+// Liefert true, falls der Task beim Dispatcher zur Ausfuehrung ansteht.
+func (t *Task) Pending() bool {
+	return t.State() == TaskScheduled
+}
+
+func (t *Task) Interval() time.Duration {
+	return t.interval
+}
+
+func (t *Task) SetInterval(i time.Duration) {
+	t.interval = i
+}
+
+func (t *Task) NumCalls() uint32 {
+	return t.numCalls
+}
+
+func (t *Task) Term() time.Duration {
+	return t.term
+}
+
+func (t *Task) AvgTerm() time.Duration {
+	if t.numCalls == 0 {
+		return 0
+	}
+	return t.term / time.Duration(t.numCalls)
+}
+
+// Liefert die kuerzeste gemessene Laufzeit.
+func (t *Task) MinTerm() time.Duration {
+	return t.minTerm
+}
+
+// Liefert die laengste gemessene Laufzeit.
+func (t *Task) MaxTerm() time.Duration {
+	return t.maxTerm
+}
+
+func (t *Task) Delay() time.Duration {
+	return t.delay
+}
+
+func (t *Task) AvgDelay() time.Duration {
+	if t.numCalls == 0 {
+		return 0
+	}
+	return t.delay / time.Duration(t.numCalls)
+}
+
+// Liefert die groesste gemessene Verspaetung.
+func (t *Task) MaxDelay() time.Duration {
+	return t.maxDelay
+}
+
+// Liefert den geglaetteten Jitter der Startzeitpunkte.
+func (t *Task) Jitter() time.Duration {
+	return t.jitter
+}
+
+// Liefert die Anzahl verpasster Deadlines.
+func (t *Task) NumMissed() uint32 {
+	return t.numMissed
+}
+
+// Liefert das Laufzeit-Budget des Tasks.
+func (t *Task) Budget() time.Duration {
+	return t.budget
+}
+
+// Setzt das Laufzeit-Budget des Tasks. Mit 0 wird die Ueberwachung
+// ausgeschaltet.
+func (t *Task) SetBudget(b time.Duration) {
+	t.budget = b
+}
+
+// Liefert die Anzahl Budget-Ueberschreitungen.
+func (t *Task) NumOverruns() uint32 {
+	return t.numOverruns
+}
+
+// Setzt alle statistischen Daten des Tasks zurueck.
+func (t *Task) ResetStats() {
+	t.lastTerm, t.term, t.delay = 0, 0, 0
+	t.minTerm, t.maxTerm = 0, 0
+	t.lastDelay, t.maxDelay, t.jitter = 0, 0, 0
+	t.numCalls, t.numMissed, t.numOverruns = 0, 0, 0
+	t.winTerm, t.prevWinTerm = 0, 0
+	t.winCalls, t.prevCalls = 0, 0
+}
+
+// Schaltet die Messung von Laufzeit und Anzahl Aufrufe pro Messfenster auf
+// das Fenster mit der Nummer idx weiter. Die Werte des letzten vollstaendigen
+// Fensters bleiben in prevWinTerm und prevCalls erhalten.
+func (t *Task) rotateWindow(idx int64) {
+	if idx == t.winIdx {
+		return
+	}
+	if idx == t.winIdx+1 {
+		t.prevWinTerm, t.prevCalls = t.winTerm, t.winCalls
+	} else {
+		t.prevWinTerm, t.prevCalls = 0, 0
+	}
+	t.winTerm, t.winCalls = 0, 0
+	t.winIdx = idx
+}
+
+// Liefert eine Momentaufnahme der Statistik dieses Tasks. CPUShare und
+// CallsPerSec beziehen sich auf das letzte vollstaendige Messfenster.
+func (t *Task) Stats() TaskStats {
+	return t.dispatcher().taskStats(t)
+}
+
+// Verbucht die Laufzeit der letzten Ausfuehrung im Messfenster idx.
+func (t *Task) account(idx int64) {
+	t.rotateWindow(idx)
+	t.winTerm += t.lastTerm
+	t.winCalls += 1
+}
+
+// Erstellt die Momentaufnahme fuer Stats, idx ist die Nummer des aktuellen
+// Messfensters.
+func (t *Task) stats(idx int64) TaskStats {
+	t.rotateWindow(idx)
+	window := float32(loadMeasureLengthMS) / 1000.0
+	return TaskStats{
+		Name:        t.name,
+		State:       t.state,
+		Interval:    t.interval,
+		NumCalls:    t.numCalls,
+		AvgTerm:     t.AvgTerm(),
+		MinTerm:     t.minTerm,
+		MaxTerm:     t.maxTerm,
+		AvgDelay:    t.AvgDelay(),
+		MaxDelay:    t.maxDelay,
+		Jitter:      t.jitter,
+		NumMissed:   t.numMissed,
+		NumOverruns: t.numOverruns,
+		CPUShare:    100.0 * float32(t.prevWinTerm) / float32(loadMeasureLengthMS*time.Millisecond),
+		CallsPerSec: float32(t.prevCalls) / window,
+	}
+}
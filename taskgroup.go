@@ -0,0 +1,204 @@
+package tinylib
+
+import (
+	"sync"
+	"time"
+)
+
+// Mit einer Taskgruppe koennen mehrere Tasks (bspw. alle Tasks eines
+// Bildschirms) gemeinsam angehalten, fortgesetzt oder entfernt werden.
+// Gruppen koennen verschachtelt werden, d.h. eine Gruppe kann ihrerseits
+// Untergruppen enthalten (bspw. fuer einzelne Widgets eines Bildschirms).
+//
+//	screen := tinylib.Disp.NewTaskGroup("main")
+//	screen.AddTask(btn.Task())
+//	screen.AddTask(enc.Task())
+//	clock := screen.NewGroup("clock")
+//	clock.AddTask(clockTask)
+//	...
+//	screen.Remove()
+//
+// Die Methoden duerfen aus beliebigen Goroutinen und auch innerhalb von
+// Tasks aufgerufen werden (relevant fuer den Dispatcher aus
+// dispatcher_goroutine.go).
+type TaskGroup struct {
+	name     string
+	disp     *Dispatcher
+	mu       sync.Mutex
+	parent   *TaskGroup
+	tasks    []*Task
+	groups   []*TaskGroup
+	isPaused bool
+}
+
+// Zusammengefasste Statistik einer Taskgruppe inkl. aller Untergruppen.
+type TaskGroupStats struct {
+	Name                   string
+	NumTasks               int
+	NumCalls               uint32
+	Term                   time.Duration
+	NumMissed, NumOverruns uint32
+	// Anteil an der CPU-Zeit im letzten vollstaendigen Messfenster in
+	// Prozent.
+	CPUShare float32
+}
+
+// Erzeugt eine neue, leere Taskgruppe, deren Tasks von diesem Dispatcher
+// ausgefuehrt werden.
+func (d *Dispatcher) NewTaskGroup(name string) *TaskGroup {
+	return &TaskGroup{name: name, disp: d}
+}
+
+// Erzeugt eine neue Untergruppe dieser Gruppe.
+func (g *TaskGroup) NewGroup(name string) *TaskGroup {
+	sub := g.disp.NewTaskGroup(name)
+	sub.parent = g
+	g.mu.Lock()
+	sub.isPaused = g.isPaused
+	g.groups = append(g.groups, sub)
+	g.mu.Unlock()
+	return sub
+}
+
+func (g *TaskGroup) Name() string {
+	return g.name
+}
+
+// Liefert die Tasks dieser Gruppe (ohne diejenigen der Untergruppen).
+func (g *TaskGroup) Tasks() []*Task {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*Task(nil), g.tasks...)
+}
+
+// Liefert die Untergruppen dieser Gruppe.
+func (g *TaskGroup) Groups() []*TaskGroup {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*TaskGroup(nil), g.groups...)
+}
+
+// Fuegt den Task t der Gruppe und dem Dispatcher hinzu. Ist die Gruppe
+// angehalten, so wird t im Zustand TaskPaused hinzugefuegt und erst mit
+// Resume eingeplant.
+func (g *TaskGroup) AddTask(t *Task) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tasks = append(g.tasks, t)
+	g.disp.add(t, g.isPaused)
+}
+
+// Entfernt den Task t aus der Gruppe und aus dem Dispatcher.
+func (g *TaskGroup) RemoveTask(t *Task) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, task := range g.tasks {
+		if task == t {
+			g.tasks = append(g.tasks[:i], g.tasks[i+1:]...)
+			g.disp.RemoveTask(t)
+			return
+		}
+	}
+}
+
+// Haelt alle Tasks dieser Gruppe und ihrer Untergruppen an.
+func (g *TaskGroup) Pause() {
+	g.mu.Lock()
+	g.isPaused = true
+	for _, t := range g.tasks {
+		g.disp.Pause(t)
+	}
+	groups := append([]*TaskGroup(nil), g.groups...)
+	g.mu.Unlock()
+	for _, sub := range groups {
+		sub.Pause()
+	}
+}
+
+// Setzt alle angehaltenen Tasks dieser Gruppe und ihrer Untergruppen fort.
+func (g *TaskGroup) Resume() {
+	g.mu.Lock()
+	g.isPaused = false
+	for _, t := range g.tasks {
+		g.disp.Resume(t)
+	}
+	groups := append([]*TaskGroup(nil), g.groups...)
+	g.mu.Unlock()
+	for _, sub := range groups {
+		sub.Resume()
+	}
+}
+
+// Liefert true, falls die Gruppe mit Pause angehalten wurde.
+func (g *TaskGroup) IsPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.isPaused
+}
+
+// Entfernt alle Tasks dieser Gruppe und ihrer Untergruppen aus dem
+// Dispatcher und loest die Gruppe von ihrer uebergeordneten Gruppe. Danach
+// ist die Gruppe leer und kann neu befuellt werden.
+func (g *TaskGroup) Remove() {
+	g.mu.Lock()
+	p := g.parent
+	g.parent = nil
+	g.mu.Unlock()
+	if p != nil {
+		p.mu.Lock()
+		for i, sub := range p.groups {
+			if sub == g {
+				p.groups = append(p.groups[:i], p.groups[i+1:]...)
+				break
+			}
+		}
+		p.mu.Unlock()
+	}
+	g.removeAll()
+}
+
+// Entfernt alle Tasks und Untergruppen, ohne die Gruppe von ihrer
+// uebergeordneten Gruppe zu loesen.
+func (g *TaskGroup) removeAll() {
+	g.mu.Lock()
+	for _, t := range g.tasks {
+		g.disp.RemoveTask(t)
+	}
+	groups := g.groups
+	g.tasks = g.tasks[:0]
+	g.groups = nil
+	g.mu.Unlock()
+	for _, sub := range groups {
+		sub.mu.Lock()
+		sub.parent = nil
+		sub.mu.Unlock()
+		sub.removeAll()
+	}
+}
+
+// Liefert die zusammengefasste Statistik aller Tasks dieser Gruppe und
+// ihrer Untergruppen.
+func (g *TaskGroup) Stats() TaskGroupStats {
+	s := TaskGroupStats{Name: g.name}
+	g.addStats(&s)
+	return s
+}
+
+func (g *TaskGroup) addStats(s *TaskGroupStats) {
+	g.mu.Lock()
+	tasks := append([]*Task(nil), g.tasks...)
+	groups := append([]*TaskGroup(nil), g.groups...)
+	g.mu.Unlock()
+	for _, t := range tasks {
+		ts := t.Stats()
+		s.NumTasks += 1
+		s.NumCalls += ts.NumCalls
+		s.Term += t.Term()
+		s.NumMissed += ts.NumMissed
+		s.NumOverruns += ts.NumOverruns
+		s.CPUShare += ts.CPUShare
+	}
+	for _, sub := range groups {
+		sub.addStats(s)
+	}
+}
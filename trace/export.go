@@ -0,0 +1,213 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Threads, auf welche die Ereignisse im Chrome-Format verteilt werden.
+const (
+	chromeTidTasks = iota + 1
+	chromeTidSpans
+	chromeTidEvents
+)
+
+type chromeEvent struct {
+	Name string            `json:"name"`
+	Ph   string            `json:"ph"`
+	Ts   float64           `json:"ts"`
+	Pid  int               `json:"pid"`
+	Tid  int               `json:"tid"`
+	S    string            `json:"s,omitempty"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// Schreibt die Aufzeichnung im Format trace_event von Chrome (JSON), wie
+// es bspw. von Perfetto (ui.perfetto.dev) gelesen wird. Tasks, markierte
+// Abschnitte und Ereignisse ohne Dauer (Post, Mark) erscheinen als je ein
+// eigener Thread.
+func (t *Trace) WriteChrome(w io.Writer) error {
+	events := []chromeEvent{
+		chromeThread(chromeTidTasks, "tasks"),
+		chromeThread(chromeTidSpans, "spans"),
+		chromeThread(chromeTidEvents, "events"),
+	}
+	var running bool
+	for _, ev := range t.Events {
+		ce := chromeEvent{
+			Name: t.Name(ev.ID),
+			Ts:   float64(ev.Time) / float64(time.Microsecond),
+		}
+		switch ev.Kind {
+		case TaskStart:
+			ce.Ph, ce.Tid = "B", chromeTidTasks
+			running = true
+		case TaskStop:
+			// Beginnt die Aufzeichnung waehrend eines Tasks, so fehlt
+			// dessen Start.
+			if !running {
+				continue
+			}
+			ce.Ph, ce.Tid = "E", chromeTidTasks
+			running = false
+		case Begin:
+			ce.Ph, ce.Tid = "B", chromeTidSpans
+		case End:
+			ce.Ph, ce.Tid = "E", chromeTidSpans
+		case Mark:
+			ce.Ph, ce.Tid, ce.S = "i", chromeTidEvents, "t"
+		case Post:
+			ce.Name = "post"
+			ce.Ph, ce.Tid, ce.S = "i", chromeTidEvents, "t"
+			ce.Args = map[string]string{"arg": fmt.Sprint(ev.ID)}
+		default:
+			continue
+		}
+		events = append(events, ce)
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{events, "ms"}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func chromeThread(tid int, name string) chromeEvent {
+	return chromeEvent{Name: "thread_name", Ph: "M", Tid: tid,
+		Args: map[string]string{"name": name}}
+}
+
+//----------------------------------------------------------------------------
+
+// Gruppen von Signalen im VCD-Format.
+const (
+	vcdTasks = iota
+	vcdSpans
+	vcdMarks
+	vcdPosts
+)
+
+var vcdScopes = [...]string{"tasks", "spans", "marks", "posts"}
+
+type vcdSignal struct {
+	group int
+	name  string
+	code  string
+}
+
+type vcdChange struct {
+	us    uint64
+	value byte
+	code  string
+}
+
+// Schreibt die Aufzeichnung als Value Change Dump (VCD) mit einer Zeitbasis
+// von 1 us, bspw. fuer GTKWave. Jeder Task und jeder markierte Abschnitt
+// wird zu einem Signal, welches waehrend der Ausfuehrung auf 1 steht.
+// Ereignisse ohne Dauer (Mark, Post) erscheinen als Puls von 1 us.
+func (t *Trace) WriteVCD(w io.Writer) error {
+	type key struct {
+		group int
+		id    uint16
+	}
+	signals := make(map[key]*vcdSignal)
+	var order []*vcdSignal
+	var changes []vcdChange
+
+	signal := func(group int, id uint16, name string) string {
+		k := key{group, id}
+		if s, ok := signals[k]; ok {
+			return s.code
+		}
+		s := &vcdSignal{group: group, name: vcdName(name), code: vcdCode(len(order))}
+		signals[k] = s
+		order = append(order, s)
+		return s.code
+	}
+
+	for _, ev := range t.Events {
+		us := uint64(ev.Time / time.Microsecond)
+		switch ev.Kind {
+		case TaskStart, TaskStop:
+			code := signal(vcdTasks, ev.ID, t.Name(ev.ID))
+			changes = append(changes, vcdChange{us, vcdLevel(ev.Kind == TaskStart), code})
+		case Begin, End:
+			code := signal(vcdSpans, ev.ID, t.Name(ev.ID))
+			changes = append(changes, vcdChange{us, vcdLevel(ev.Kind == Begin), code})
+		case Mark, Post:
+			var code string
+			if ev.Kind == Mark {
+				code = signal(vcdMarks, ev.ID, t.Name(ev.ID))
+			} else {
+				code = signal(vcdPosts, 0, "post")
+			}
+			changes = append(changes, vcdChange{us, '1', code},
+				vcdChange{us + 1, '0', code})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].us < changes[j].us
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$timescale 1us $end\n$scope module tinylib $end\n")
+	for group, scope := range vcdScopes {
+		fmt.Fprintf(bw, "$scope module %s $end\n", scope)
+		for _, s := range order {
+			if s.group == group {
+				fmt.Fprintf(bw, "$var wire 1 %s %s $end\n", s.code, s.name)
+			}
+		}
+		fmt.Fprintf(bw, "$upscope $end\n")
+	}
+	fmt.Fprintf(bw, "$upscope $end\n$enddefinitions $end\n#0\n$dumpvars\n")
+	for _, s := range order {
+		fmt.Fprintf(bw, "0%s\n", s.code)
+	}
+	fmt.Fprintf(bw, "$end\n")
+	last := uint64(0)
+	for _, c := range changes {
+		if c.us != last {
+			fmt.Fprintf(bw, "#%d\n", c.us)
+			last = c.us
+		}
+		fmt.Fprintf(bw, "%c%s\n", c.value, c.code)
+	}
+	return bw.Flush()
+}
+
+func vcdLevel(high bool) byte {
+	if high {
+		return '1'
+	}
+	return '0'
+}
+
+// Liefert den Identifikationscode des Signals mit Nummer n (druckbare
+// ASCII-Zeichen von '!' bis '~').
+func vcdCode(n int) string {
+	code := []byte{byte('!' + n%94)}
+	for n /= 94; n > 0; n /= 94 {
+		code = append(code, byte('!'+n%94))
+	}
+	return string(code)
+}
+
+// Ersetzt alle Zeichen, welche in VCD-Namen nicht erlaubt sind.
+func vcdName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,174 @@
+// Dieses Package enthaelt das Format der Aufzeichnungen von tinylib.Tracer
+// sowie den Decoder und die Exporte nach Chrome trace_event JSON (Perfetto,
+// chrome://tracing) und VCD (GTKWave). Es ist reines Go und kann damit
+// sowohl auf dem Microcontroller als auch auf dem Host verwendet werden.
+//
+// Eine Aufzeichnung besteht aus einem Header, der Namenstabelle und den
+// Ereignissen (alle Werte little endian):
+//
+//	Header   : Magic "TLTR", Version (1 Byte), reserviert (1 Byte),
+//	           Anzahl Namen (2 Bytes)
+//	Name     : ID (2 Bytes), Laenge (1 Byte), Name
+//	Anzahl   : Anzahl Ereignisse (4 Bytes)
+//	Ereignis : Zeit in us (4 Bytes), Kind (1 Byte), reserviert (1 Byte),
+//	           ID (2 Bytes)
+//
+// Die Zeit laeuft nach rund 71 Minuten ueber, der Decoder korrigiert dies,
+// solange zwischen zwei Ereignissen weniger als die Haelfte dieser Zeit
+// liegt.
+package trace
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	Magic   = "TLTR"
+	Version = 1
+	// Groesse eines Ereignisses in Bytes.
+	EventSize = 8
+)
+
+var (
+	ErrFormat = errors.New("trace: bad format")
+)
+
+// Art eines Ereignisses.
+type Kind uint8
+
+const (
+	// Ein Task wird gestartet bzw. ist beendet (ID des Tasks).
+	TaskStart Kind = iota + 1
+	TaskStop
+	// Eine Funktion wurde mit Post (ID 0) oder PostEvent (ID = die unteren
+	// 16 Bit des Arguments) uebergeben.
+	Post
+	// Eine Markierung ohne Dauer.
+	Mark
+	// Beginn bzw. Ende eines markierten Abschnitts.
+	Begin
+	End
+)
+
+func (k Kind) String() string {
+	switch k {
+	case TaskStart:
+		return "TaskStart"
+	case TaskStop:
+		return "TaskStop"
+	case Post:
+		return "Post"
+	case Mark:
+		return "Mark"
+	case Begin:
+		return "Begin"
+	case End:
+		return "End"
+	default:
+		return "(unspec. kind)"
+	}
+}
+
+type Event struct {
+	// Zeit seit dem Start der Aufzeichnung.
+	Time time.Duration
+	Kind Kind
+	ID   uint16
+}
+
+// Eine dekodierte Aufzeichnung.
+type Trace struct {
+	Names  map[uint16]string
+	Events []Event
+}
+
+// Liefert den Namen zur ID id. Ist keiner bekannt, so wird "#<id>"
+// retourniert.
+func (t *Trace) Name(id uint16) string {
+	if name, ok := t.Names[id]; ok && name != "" {
+		return name
+	}
+	return "#" + strconv.Itoa(int(id))
+}
+
+// Liest eine Aufzeichnung von r.
+func Decode(r io.Reader) (*Trace, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if string(hdr[:4]) != Magic || hdr[4] != Version {
+		return nil, ErrFormat
+	}
+	t := &Trace{Names: make(map[uint16]string)}
+	numNames := int(binary.LittleEndian.Uint16(hdr[6:]))
+	for range numNames {
+		var buf [3]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, err
+		}
+		name := make([]byte, buf[2])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, err
+		}
+		t.Names[binary.LittleEndian.Uint16(buf[:])] = string(name)
+	}
+	var cnt [4]byte
+	if _, err := io.ReadFull(r, cnt[:]); err != nil {
+		return nil, err
+	}
+	numEvents := binary.LittleEndian.Uint32(cnt[:])
+	t.Events = make([]Event, 0, numEvents)
+	var base, prev uint64
+	for i := uint32(0); i < numEvents; i++ {
+		var buf [EventSize]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, err
+		}
+		us := uint64(binary.LittleEndian.Uint32(buf[:]))
+		if i > 0 && us+base < prev && prev-(us+base) > 1<<31 {
+			base += 1 << 32
+		}
+		prev = us + base
+		t.Events = append(t.Events, Event{
+			Time: time.Duration(prev) * time.Microsecond,
+			Kind: Kind(buf[4]),
+			ID:   binary.LittleEndian.Uint16(buf[6:]),
+		})
+	}
+	return t, nil
+}
+
+// Haengt den Header einer Aufzeichnung mit numNames Namen an buf an.
+func AppendHeader(buf []byte, numNames int) []byte {
+	buf = append(buf, Magic...)
+	buf = append(buf, Version, 0)
+	return binary.LittleEndian.AppendUint16(buf, uint16(numNames))
+}
+
+// Haengt einen Eintrag der Namenstabelle an buf an. Namen werden auf 255
+// Bytes gekuerzt.
+func AppendName(buf []byte, id uint16, name string) []byte {
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, id)
+	buf = append(buf, byte(len(name)))
+	return append(buf, name...)
+}
+
+// Haengt die Anzahl der folgenden Ereignisse an buf an.
+func AppendCount(buf []byte, n uint32) []byte {
+	return binary.LittleEndian.AppendUint32(buf, n)
+}
+
+// Haengt ein Ereignis an buf an. us ist die Zeit in Mikrosekunden.
+func AppendEvent(buf []byte, us uint32, kind Kind, id uint16) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, us)
+	buf = append(buf, byte(kind), 0)
+	return binary.LittleEndian.AppendUint16(buf, id)
+}
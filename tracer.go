@@ -0,0 +1,165 @@
+package tinylib
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"tinylib/trace"
+)
+
+// Der Tracer zeichnet den Start und das Ende von Tasks, Aufrufe von Post
+// und PostEvent sowie eigene Markierungen mit Zeitstempeln in Mikrosekunden
+// in einem Ringpuffer fester Groesse auf. Ist der Puffer voll, so werden
+// die aeltesten Eintraege ueberschrieben. Die Aufzeichnung wird mit WriteTo
+// ausgegeben (bspw. ueber die serielle Schnittstelle) und auf dem Host mit
+// cmd/tracedump fuer Perfetto oder GTKWave umgewandelt.
+//
+//	tr := &tinylib.Tracer{}
+//	tr.Configure(tinylib.TracerConfig{Size: 2048})
+//	tinylib.Disp.SetTracer(tr)
+//	redraw := tr.Marker("redraw")
+//	...
+//	tr.Begin(redraw)
+//	screen.Redraw()
+//	tr.End(redraw)
+//	...
+//	tr.WriteTo(os.Stdout)
+//
+// Das Aufzeichnen ist auch aus Interrupt-Routinen erlaubt.
+type Tracer struct {
+	clock   Clock
+	start   time.Time
+	entries []traceEntry
+	idx     atomic.Uint32
+	names   []string
+}
+
+type TracerConfig struct {
+	// Anzahl Eintraege im Ringpuffer, jeder belegt 8 Bytes (Default: 1024).
+	Size int
+	// Zeitquelle (Default: SystemClock).
+	Clock Clock
+}
+
+const (
+	defTracerSize = 1024
+)
+
+type traceEntry struct {
+	us   uint32
+	kind trace.Kind
+	id   uint16
+}
+
+func (tr *Tracer) Configure(cfg TracerConfig) {
+	if cfg.Size == 0 {
+		cfg.Size = defTracerSize
+	}
+	tr.clock = cfg.Clock
+	if tr.clock == nil {
+		tr.clock = SystemClock{}
+	}
+	tr.entries = make([]traceEntry, cfg.Size)
+	tr.Reset()
+}
+
+// Setzt den Tracer als Aufzeichnung des Dispatchers. Mit nil wird die
+// Aufzeichnung beendet. Wurde tr noch nicht konfiguriert, so geschieht dies
+// hier mit den Defaults. Die Namen aller Tasks des Dispatchers werden dabei
+// registriert, diejenigen spaeter hinzugefuegter Tasks bei AddTask.
+func (d *Dispatcher) SetTracer(tr *Tracer) {
+	if tr != nil && len(tr.entries) == 0 {
+		tr.Configure(TracerConfig{})
+	}
+	d.tracer = tr
+	if tr != nil {
+		for _, t := range d.tasks {
+			tr.addTask(t)
+		}
+	}
+}
+
+// Loescht alle Eintraege; die Zeit der Aufzeichnung beginnt wieder bei 0.
+func (tr *Tracer) Reset() {
+	tr.start = tr.clock.Now()
+	tr.idx.Store(0)
+}
+
+// Registriert eine Markierung mit dem Namen name und liefert deren ID fuer
+// Mark, Begin und End.
+func (tr *Tracer) Marker(name string) uint16 {
+	tr.names = append(tr.names, name)
+	return uint16(len(tr.names))
+}
+
+// Zeichnet die Markierung id auf.
+func (tr *Tracer) Mark(id uint16) {
+	tr.record(trace.Mark, id)
+}
+
+// Markiert den Beginn eines Abschnitts.
+func (tr *Tracer) Begin(id uint16) {
+	tr.record(trace.Begin, id)
+}
+
+// Markiert das Ende eines Abschnitts.
+func (tr *Tracer) End(id uint16) {
+	tr.record(trace.End, id)
+}
+
+// Registriert den Namen des Tasks t und vergibt ihm damit seine ID.
+func (tr *Tracer) addTask(t *Task) {
+	t.traceID = tr.Marker(t.name)
+}
+
+func (tr *Tracer) taskStart(t *Task) {
+	tr.record(trace.TaskStart, t.traceID)
+}
+
+func (tr *Tracer) taskStop(t *Task) {
+	tr.record(trace.TaskStop, t.traceID)
+}
+
+func (tr *Tracer) post(arg uint32) {
+	tr.record(trace.Post, uint16(arg))
+}
+
+// Ohne Configure (bzw. SetTracer) wird nichts aufgezeichnet.
+func (tr *Tracer) record(kind trace.Kind, id uint16) {
+	if len(tr.entries) == 0 {
+		return
+	}
+	us := uint32(tr.clock.Now().Sub(tr.start) / time.Microsecond)
+	i := tr.idx.Add(1) - 1
+	tr.entries[i%uint32(len(tr.entries))] = traceEntry{us: us, kind: kind, id: id}
+}
+
+// Schreibt die Aufzeichnung im Format von tinylib/trace nach w. Die
+// Aufzeichnung laeuft dabei weiter.
+func (tr *Tracer) WriteTo(w io.Writer) (int64, error) {
+	n := tr.idx.Load()
+	size := uint32(len(tr.entries))
+	first := uint32(0)
+	if n > size {
+		first = n - size
+	}
+	buf := trace.AppendHeader(nil, len(tr.names))
+	for i, name := range tr.names {
+		buf = trace.AppendName(buf, uint16(i+1), name)
+	}
+	buf = trace.AppendCount(buf, n-first)
+	written, err := w.Write(buf)
+	total := int64(written)
+	var chunk [32 * trace.EventSize]byte
+	for i := first; i < n && err == nil; {
+		buf = chunk[:0]
+		for ; i < n && len(buf) < len(chunk); i++ {
+			e := tr.entries[i%size]
+			buf = trace.AppendEvent(buf, e.us, e.kind, e.id)
+		}
+		written, err = w.Write(buf)
+		total += int64(written)
+	}
+	return total, err
+}
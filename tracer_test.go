@@ -0,0 +1,25 @@
+//go:build inline
+
+package tinylib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracerZeroValue(t *testing.T) {
+	d, clk := newTestDispatcher()
+	d.AddTask(NewTask(func() {}, TaskConfig{Name: "early", Interval: time.Millisecond}))
+	tr := &Tracer{}
+	tr.Mark(tr.Marker("unconfigured"))
+	d.SetTracer(tr)
+	d.AddTask(NewTask(func() {}, TaskConfig{Name: "late", Interval: time.Millisecond}))
+	numNames := len(tr.names)
+	clk.RunUntil(clk.Now().Add(10*time.Millisecond), d)
+	if len(tr.names) != numNames || numNames != 3 {
+		t.Fatalf("got names %v", tr.names)
+	}
+	if n := tr.idx.Load(); n < 20 {
+		t.Fatalf("only %d events recorded", n)
+	}
+}
@@ -0,0 +1,285 @@
+package tinylib
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+)
+
+// Der Supervisor ueberwacht kritische Tasks und fuettert den Hardware-
+// Watchdog nur dann, wenn alle ueberwachten Tasks innerhalb ihrer Deadline
+// eingecheckt haben. Verpasst ein Task seine Deadline, so wird ein
+// Diagnosedatensatz (DiagRecord) erstellt, im Store abgelegt und dem
+// Failure-Callback uebergeben. Danach wird der Watchdog nicht mehr
+// gefuettert und der Microcontroller neu gestartet.
+//
+//	machine.Watchdog.Configure(machine.WatchdogConfig{TimeoutMillis: 1000})
+//	sup := &tinylib.Supervisor{}
+//	sup.Configure(tinylib.SupervisorConfig{
+//	    Watchdog: machine.Watchdog,
+//	    Store:    tinylib.NewFlashStore(0),
+//	})
+//	if rec, err := sup.LastDiag(); err == nil {
+//	    println("reset by", rec.Watch, "while running", rec.Running)
+//	    sup.ClearDiag()
+//	}
+//	sup.WatchTask(dabTask, 2*time.Second)
+//	tinylib.Cores[1].AddTask(sup.Task())
+//	machine.Watchdog.Start()
+//
+// Haengt ein Task in einer Schleife, so wird der Dispatcher, auf welchem
+// er laeuft, blockiert. Damit der Supervisor dies feststellen und den
+// haengenden Task im Diagnosedatensatz vermerken kann, muss sein Task auf
+// einem anderen Dispatcher laufen (anderer Kern oder Dispatcher mit
+// Goroutinen). Laeuft er auf demselben Dispatcher, so wird der Watchdog
+// zwar ebenfalls nicht mehr gefuettert, ein Diagnosedatensatz entsteht
+// dann jedoch nicht.
+type Supervisor struct {
+	interval  time.Duration
+	wdt       WatchdogFeeder
+	store     Store
+	disp      *Dispatcher
+	watches   []*Watch
+	failureCB FailureCallback
+	isFailed  bool
+}
+
+// Das Einzige, was der Supervisor vom Hardware-Watchdog braucht.
+// machine.Watchdog erfuellt dieses Interface.
+type WatchdogFeeder interface {
+	Update()
+}
+
+type SupervisorConfig struct {
+	// Pruefintervall, in diesem Takt wird auch der Watchdog gefuettert
+	// (Default: 100 ms). Das Timeout des Watchdogs muss deutlich groesser
+	// sein.
+	Interval time.Duration
+	// Hardware-Watchdog, welcher bereits konfiguriert sein muss. Mit nil
+	// wird nur ueberwacht und protokolliert.
+	Watchdog WatchdogFeeder
+	// Persistenter Speicher fuer den Diagnosedatensatz (Default: nil, d.h.
+	// der Datensatz wird nicht gespeichert).
+	Store Store
+	// Dispatcher, dessen laufender Task im Diagnosedatensatz vermerkt wird
+	// (Default: Disp).
+	Dispatcher *Dispatcher
+}
+
+const (
+	defSupervisorInterval = 100 * time.Millisecond
+)
+
+// Enthaelt die Angaben zu einer verpassten Deadline.
+type DiagRecord struct {
+	// Name der Ueberwachung bzw. des Tasks, welcher nicht rechtzeitig
+	// eingecheckt hat.
+	Watch string
+	// Name des Tasks, welcher zu diesem Zeitpunkt ausgefuehrt wurde (leer,
+	// falls kein Task lief).
+	Running string
+	// Um so viel wurde die Deadline ueberschritten.
+	Overdue time.Duration
+	// Zeitpunkt der Feststellung gemaess Dispatcher-Uhr.
+	Time time.Time
+}
+
+// Funktionstyp des Callback-Handlers fuer verpasste Deadlines.
+type FailureCallback func(rec DiagRecord)
+
+// Eine einzelne Ueberwachung. Sie gilt als eingecheckt, wenn CheckIn
+// aufgerufen wurde oder - bei Ueberwachungen von Tasks - wenn der Task
+// seit der letzten Pruefung ausgefuehrt wurde.
+type Watch struct {
+	name       string
+	deadline   time.Duration
+	task       *Task
+	numCalls   uint32
+	numChecks  atomic.Uint32
+	lastChecks uint32
+	lastSeen   time.Time
+}
+
+func (s *Supervisor) Configure(cfg SupervisorConfig) {
+	s.interval = cfg.Interval
+	if s.interval == 0 {
+		s.interval = defSupervisorInterval
+	}
+	s.wdt = cfg.Watchdog
+	s.store = cfg.Store
+	s.disp = cfg.Dispatcher
+	if s.disp == nil {
+		s.disp = Disp
+	}
+}
+
+// Setzt cb als Diagnose-Hook, welcher bei einer verpassten Deadline
+// aufgerufen wird, bevor der Watchdog nicht mehr gefuettert wird.
+func (s *Supervisor) SetOnFailure(cb FailureCallback) {
+	s.failureCB = cb
+}
+
+// Erzeugt eine neue Ueberwachung mit Namen name. Zwischen zwei Aufrufen von
+// Watch.CheckIn duerfen hoechstens deadline vergehen.
+func (s *Supervisor) Watch(name string, deadline time.Duration) *Watch {
+	w := &Watch{name: name, deadline: deadline}
+	w.lastSeen = s.disp.Now()
+	s.watches = append(s.watches, w)
+	return w
+}
+
+// Ueberwacht den Task t: er muss mindestens alle deadline ausgefuehrt
+// werden. Ist t angehalten oder nicht eingeplant, so wird er nicht
+// ueberwacht.
+func (s *Supervisor) WatchTask(t *Task, deadline time.Duration) *Watch {
+	w := s.Watch(t.Name(), deadline)
+	w.task = t
+	w.numCalls = t.NumCalls()
+	return w
+}
+
+// Beendet die Ueberwachung w.
+func (s *Supervisor) Unwatch(w *Watch) {
+	for i, watch := range s.watches {
+		if watch == w {
+			s.watches = append(s.watches[:i], s.watches[i+1:]...)
+			return
+		}
+	}
+}
+
+// Meldet, dass die ueberwachte Aktivitaet noch lebt. Darf von jedem Kern
+// und aus Interrupt-Routinen aufgerufen werden.
+func (w *Watch) CheckIn() {
+	w.numChecks.Add(1)
+}
+
+// Liefert true, falls seit dem letzten Aufruf ein Check-in erfolgt ist.
+func (w *Watch) progressed() bool {
+	checks := w.numChecks.Load()
+	ok := checks != w.lastChecks
+	w.lastChecks = checks
+	if w.task != nil {
+		calls := w.task.NumCalls()
+		ok = ok || calls != w.numCalls
+		w.numCalls = calls
+	}
+	return ok
+}
+
+// Liefert true, falls seit dem Start eine Deadline verpasst wurde.
+func (s *Supervisor) Failed() bool {
+	return s.isFailed
+}
+
+func (s *Supervisor) Task() *Task {
+	return NewTask(s.Tick, TaskConfig{Interval: s.interval, Name: "supervisor"})
+}
+
+// Prueft alle Ueberwachungen und fuettert den Watchdog, falls alle
+// rechtzeitig eingecheckt haben.
+func (s *Supervisor) Tick() {
+	if s.isFailed {
+		return
+	}
+	now := s.disp.Now()
+	for _, w := range s.watches {
+		if w.progressed() {
+			w.lastSeen = now
+			continue
+		}
+		if w.task != nil {
+			if state := w.task.State(); state != TaskScheduled && state != TaskRunning {
+				w.lastSeen = now
+				continue
+			}
+		}
+		if overdue := now.Sub(w.lastSeen) - w.deadline; overdue > 0 {
+			s.fail(w, overdue, now)
+			return
+		}
+	}
+	if s.wdt != nil {
+		s.wdt.Update()
+	}
+}
+
+func (s *Supervisor) fail(w *Watch, overdue time.Duration, now time.Time) {
+	s.isFailed = true
+	rec := DiagRecord{Watch: w.name, Overdue: overdue, Time: now}
+	if t := s.disp.Running(); t != nil {
+		rec.Running = t.Name()
+	}
+	if s.store != nil {
+		data, _ := rec.MarshalBinary()
+		s.store.Save(data)
+	}
+	if s.failureCB != nil {
+		s.failureCB(rec)
+	}
+}
+
+// Liefert den im Store abgelegten Diagnosedatensatz, typischerweise nach
+// einem Neustart. Ist keiner vorhanden, so wird ErrNoData retourniert.
+func (s *Supervisor) LastDiag() (DiagRecord, error) {
+	var rec DiagRecord
+	if s.store == nil {
+		return rec, ErrNoData
+	}
+	buf := make([]byte, diagRecordMaxSize)
+	n, err := s.store.Load(buf)
+	if err != nil {
+		return rec, err
+	}
+	err = rec.UnmarshalBinary(buf[:n])
+	return rec, err
+}
+
+// Loescht den im Store abgelegten Diagnosedatensatz.
+func (s *Supervisor) ClearDiag() error {
+	if s.store == nil {
+		return nil
+	}
+	return s.store.Save(nil)
+}
+
+//----------------------------------------------------------------------------
+
+const (
+	diagNameMaxLen    = 32
+	diagRecordMaxSize = 2 + 2*diagNameMaxLen + 16
+)
+
+// Serialisiert den Datensatz. Namen werden auf 32 Bytes gekuerzt.
+func (r DiagRecord) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, diagRecordMaxSize)
+	for _, name := range [...]string{r.Watch, r.Running} {
+		if len(name) > diagNameMaxLen {
+			name = name[:diagNameMaxLen]
+		}
+		buf = append(buf, byte(len(name)))
+		buf = append(buf, name...)
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(r.Overdue))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(r.Time.UnixMilli()))
+	return buf, nil
+}
+
+func (r *DiagRecord) UnmarshalBinary(p []byte) error {
+	var names [2]string
+	for i := range names {
+		if len(p) < 1 || len(p) < 1+int(p[0]) {
+			return ErrNoData
+		}
+		n := int(p[0])
+		names[i] = string(p[1 : 1+n])
+		p = p[1+n:]
+	}
+	if len(p) < 16 {
+		return ErrNoData
+	}
+	r.Watch, r.Running = names[0], names[1]
+	r.Overdue = time.Duration(binary.LittleEndian.Uint64(p))
+	r.Time = time.UnixMilli(int64(binary.LittleEndian.Uint64(p[8:])))
+	return nil
+}